@@ -0,0 +1,261 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  管理接口
+-------------------------------------------------
+*/
+
+package admin
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec"
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/errs"
+)
+
+// 操作名, 同时也是请求路径
+const (
+    // GET 列出已注册的加载器
+    OpLoaders = "loaders"
+    // GET 获取统计数据
+    OpStats = "stats"
+    // GET 查询数据在每一层缓存中的状态, 参数 space, param(可以有多个)
+    OpLookup = "lookup"
+    // POST/DELETE 删除数据, 参数 space, param(可以有多个)
+    OpDel = "del"
+    // POST/DELETE 删除空间的所有数据, 参数 space
+    OpDelSpace = "del_space"
+)
+
+var _ http.Handler = (*Handler)(nil)
+
+// 加载器信息
+type LoaderInfo struct {
+    Space string `json:"space"`
+    Type  string `json:"type"`
+}
+
+// 数据在一层缓存中的状态
+type TierEntry struct {
+    Tier    string      `json:"tier"`               // 层名, local 为本地缓存, cachedb 为缓存数据库, 多层缓存数据库为 cachedb.层号
+    Type    string      `json:"type"`               // 缓存数据库类型
+    Key     string      `json:"key,omitempty"`      // 数据在缓存数据库中的key
+    Found   bool        `json:"found"`              // 是否存在
+    NoEntry bool        `json:"no_entry,omitempty"` // 是否为空条目
+    TTL     string      `json:"ttl,omitempty"`      // 剩余有效时间, -1 表示永不过期
+    Value   interface{} `json:"value,omitempty"`    // 解码后的数据
+    Error   string      `json:"error,omitempty"`    // 查询出错时的错误
+}
+
+// 查询结果
+type LookupResult struct {
+    Space    string      `json:"space"`
+    Params   []string    `json:"params"`
+    FullPath string      `json:"full_path"`
+    Tiers    []TierEntry `json:"tiers"`
+}
+
+// 管理接口, 实现了 http.Handler, 请求路径的最后一段为操作名, 可以挂载在任意前缀下
+//
+// 没有通过 WithAuthorizer 设置授权函数时只允许查询操作, 删除操作会返回 403
+//
+//  mux.Handle("/zbec/", admin.New(bec, admin.WithAuthorizer(auth)))
+//  // GET  /zbec/lookup?space=user&param=1
+//  // POST /zbec/del?space=user&param=1
+type Handler struct {
+    bec       *zbec.BECache
+    authorize func(r *http.Request, op string) bool
+}
+
+func New(bec *zbec.BECache, opts ...Option) *Handler {
+    m := &Handler{bec: bec}
+    for _, o := range opts {
+        o(m)
+    }
+    return m
+}
+
+func (m *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    op := r.URL.Path
+    if i := strings.LastIndexByte(op, '/'); i >= 0 {
+        op = op[i+1:]
+    }
+
+    var handle func(r *http.Request) (interface{}, error)
+    write := false
+    switch op {
+    case OpLoaders:
+        handle = m.loaders
+    case OpStats:
+        handle = m.stats
+    case OpLookup:
+        handle = m.lookup
+    case OpDel:
+        handle, write = m.del, true
+    case OpDelSpace:
+        handle, write = m.delSpace, true
+    default:
+        writeJSON(w, http.StatusNotFound, errorBody(fmt.Sprintf("未知的操作<%s>", op)))
+        return
+    }
+
+    if write && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+        writeJSON(w, http.StatusMethodNotAllowed, errorBody("需要使用 POST 或 DELETE 方法"))
+        return
+    }
+    if !write && r.Method != http.MethodGet {
+        writeJSON(w, http.StatusMethodNotAllowed, errorBody("需要使用 GET 方法"))
+        return
+    }
+    if m.authorize == nil && write {
+        writeJSON(w, http.StatusForbidden, errorBody("没有设置授权函数时不允许修改数据"))
+        return
+    }
+    if m.authorize != nil && !m.authorize(r, op) {
+        writeJSON(w, http.StatusForbidden, errorBody("没有权限"))
+        return
+    }
+
+    out, err := handle(r)
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+        return
+    }
+    writeJSON(w, http.StatusOK, out)
+}
+
+func (m *Handler) loaders(_ *http.Request) (interface{}, error) {
+    loaders := m.bec.Loaders()
+    out := make([]LoaderInfo, 0, len(loaders))
+    for space, loader := range loaders {
+        out = append(out, LoaderInfo{Space: space, Type: fmt.Sprintf("%T", loader)})
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Space < out[j].Space })
+    return out, nil
+}
+
+func (m *Handler) stats(_ *http.Request) (interface{}, error) {
+    return m.bec.Stats(), nil
+}
+
+func (m *Handler) lookup(r *http.Request) (interface{}, error) {
+    query, err := parseQuery(r)
+    if err != nil {
+        return nil, err
+    }
+
+    out := &LookupResult{
+        Space:    query.Space(),
+        Params:   query.Params(),
+        FullPath: query.FullPath(),
+    }
+    out.Tiers = append(out.Tiers, lookupTier("local", m.bec.LocalCacheDB(), query))
+    if tcdb, ok := m.bec.CacheDB().(cachedb.ITieredCacheDB); ok {
+        for i, cdb := range tcdb.Tiers() {
+            out.Tiers = append(out.Tiers, lookupTier(fmt.Sprintf("cachedb.%d", i), cdb, query))
+        }
+    } else {
+        out.Tiers = append(out.Tiers, lookupTier("cachedb", m.bec.CacheDB(), query))
+    }
+    return out, nil
+}
+
+func (m *Handler) del(r *http.Request) (interface{}, error) {
+    query, err := parseQuery(r)
+    if err != nil {
+        return nil, err
+    }
+    if err = m.bec.DelDataWithContext(r.Context(), query); err != nil {
+        return nil, err
+    }
+    return map[string]string{"deleted": query.FullPath()}, nil
+}
+
+func (m *Handler) delSpace(r *http.Request) (interface{}, error) {
+    space := r.FormValue("space")
+    if space == "" {
+        return nil, zerrors.NewSimple("缺少参数 space")
+    }
+    if err := m.bec.DelSpaceDataWithContext(r.Context(), space); err != nil {
+        return nil, err
+    }
+    return map[string]string{"deleted_space": space}, nil
+}
+
+// 查询数据在一层缓存中的状态, 数据解码到 interface{} 中, 缓存数据库支持时使用 Peek 避免影响淘汰顺序
+func lookupTier(name string, cdb cachedb.ICacheDB, query *zbec.Query) TierEntry {
+    e := TierEntry{Tier: name, Type: fmt.Sprintf("%T", cdb)}
+    if kcdb, ok := cdb.(cachedb.IKeyCacheDB); ok {
+        key, err := kcdb.CacheKey(query)
+        if err != nil {
+            e.Error = err.Error()
+            return e
+        }
+        e.Key = key
+    }
+
+    get := cdb.Get
+    if pcdb, ok := cdb.(cachedb.IPeekCacheDB); ok {
+        get = pcdb.Peek
+    }
+    v, err := get(query, new(interface{}))
+    switch err {
+    case nil:
+        e.Found, e.Value = true, jsonValue(v)
+    case errs.NoEntry:
+        e.Found, e.NoEntry = true, true
+    case errs.ErrNoEntry:
+        return e
+    default:
+        e.Error = err.Error()
+        return e
+    }
+
+    if tcdb, ok := cdb.(cachedb.ITTLCacheDB); ok {
+        if ttl, err := tcdb.TTL(query); err == nil {
+            e.TTL = "-1"
+            if ttl >= 0 {
+                e.TTL = ttl.String()
+            }
+        }
+    }
+    return e
+}
+
+// 无法编码为json的数据转为字符串
+func jsonValue(v interface{}) interface{} {
+    if _, err := json.Marshal(v); err != nil {
+        return fmt.Sprintf("%+v", v)
+    }
+    return v
+}
+
+func parseQuery(r *http.Request) (*zbec.Query, error) {
+    if err := r.ParseForm(); err != nil {
+        return nil, err
+    }
+    space := r.Form.Get("space")
+    if space == "" {
+        return nil, zerrors.NewSimple("缺少参数 space")
+    }
+    return zbec.NewQuery(space, r.Form["param"]...), nil
+}
+
+func errorBody(msg string) map[string]string {
+    return map[string]string{"error": msg}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(code)
+    _ = json.NewEncoder(w).Encode(v)
+}
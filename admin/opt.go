@@ -0,0 +1,23 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package admin
+
+import (
+    "net/http"
+)
+
+type Option func(m *Handler)
+
+// 设置鉴权函数, op 为操作名, 返回false时响应403, 没有设置时只允许只读操作
+// 只读操作为 OpLoaders, OpStats, OpLookup, 写操作为 OpDel, OpDelSpace
+func WithAuthorizer(fn func(r *http.Request, op string) bool) Option {
+    return func(m *Handler) {
+        m.authorize = fn
+    }
+}
@@ -17,11 +17,13 @@ import (
     "sync"
     "time"
 
+    "github.com/afex/hystrix-go/hystrix"
     "github.com/vmihailenco/msgpack"
     "github.com/zlyuancn/zerrors"
     "github.com/zlyuancn/zlog2"
     "github.com/zlyuancn/zsingleflight"
 
+    "github.com/zlyuancn/zbec/bloom"
     "github.com/zlyuancn/zbec/cachedb"
     "github.com/zlyuancn/zbec/cachedb/go_cache"
     "github.com/zlyuancn/zbec/cachedb/nocache"
@@ -36,13 +38,32 @@ var (
     ErrNoEntry = errs.ErrNoEntry
     // 由缓存保存的ErrNoEntry错误
     NoEntry = errs.NoEntry
+    // db加载失败时返回了过期的数据
+    ErrStaleData = errs.ErrStaleData
+    // 缓存数据库不支持标签
+    ErrTagNotSupported = errs.ErrTagNotSupported
+    // 枚举key的函数不存在或为空
+    ErrKeysFnNotExists = errs.ErrKeysFnNotExists
+    // 加载器并发已满且等待队列已满
+    ErrLoaderOverloaded = errs.ErrLoaderOverloaded
+    // 加载器超过了设置的超时时间
+    ErrLoadTimeout = errs.ErrLoadTimeout
+    // BECache已关闭, 不再调用加载器
+    ErrClosed = errs.ErrClosed
+    // 加载器的断路器已打开
+    ErrCircuitOpen error = hystrix.ErrCircuitOpen
 )
 
+// 缓存数据库中的数据已过期, 仅作为db加载失败时的备用数据
+var errExpiredEntry = errors.New("条目已过期")
+
 const (
     // 默认本地缓存有效时间
     DefaultLocalCacheExpire = time.Second
     // 默认缓存空条目有效时间
     DefaultCacheNoEntryExpire = time.Second * 5
+    // 默认共享加载超时时间
+    DefaultSharedLoadTimeout = time.Second * 10
 )
 
 type Query = query.Query
@@ -61,11 +82,29 @@ type BECache struct {
     default_ex    time.Duration // 默认缓存开始时间
     default_endex time.Duration // 默认缓存结束时间
 
+    stale_ex time.Duration // 过期数据保留时间
+
+    shared_load_timeout time.Duration // 同一个key的并发请求共享的加载超时时间
+
     sf      ISingleFlight      // 单飞
     loaders map[string]ILoader // 加载器配置
     mx      sync.RWMutex       // 对注册的加载器加锁
     log     ILoger             // 日志组件
 
+    refreshing   sync.Map                 // 正在后台刷新的key
+    stats        *statsRecorder           // 统计模块
+    interceptors []Interceptor            // 拦截器
+    tracer       ITracer                  // 链路追踪器
+    bus          cachedb.IInvalidationBus // 本地缓存失效总线
+    subscribed   cachedb.IInvalidationBus // 已订阅的失效总线
+    filters      map[string]bloom.IFilter // 每个空间的布隆过滤器
+    limiters     sync.Map                 // 每个空间的加载器并发限制器
+
+    closed     bool           // 是否已关闭
+    close_mx   sync.RWMutex   // 关闭锁
+    close_once sync.Once      // 保证只关闭一次缓存数据库
+    loads      sync.WaitGroup // 正在进行的加载和后台刷新
+
     deepcopy_result bool // 对结果进行深拷贝
 }
 
@@ -82,14 +121,20 @@ func New(c cachedb.ICacheDB, opts ...Option) *BECache {
         default_ex:    0,
         default_endex: 0,
 
+        shared_load_timeout: DefaultSharedLoadTimeout,
+
         sf:      zsingleflight.New(),
         loaders: make(map[string]ILoader),
+        filters: make(map[string]bloom.IFilter),
         log:     zlog2.DefaultLogger,
+
+        stats: newStatsRecorder(),
     }
 
     for _, o := range opts {
         o(m)
     }
+    m.subscribe()
     return m
 }
 
@@ -106,6 +151,7 @@ func (m *BECache) SetOptions(opts ...Option) {
     for _, o := range opts {
         o(m)
     }
+    m.subscribe()
 }
 
 // 为空间注册加载器, 空间名为加载器名, 已注册的空间会被新的加载器替换掉
@@ -115,6 +161,27 @@ func (m *BECache) RegisterLoader(loader ILoader) {
     m.mx.Unlock()
 }
 
+// 获取所有已注册的加载器, key为空间名
+func (m *BECache) Loaders() map[string]ILoader {
+    m.mx.RLock()
+    out := make(map[string]ILoader, len(m.loaders))
+    for space, loader := range m.loaders {
+        out[space] = loader
+    }
+    m.mx.RUnlock()
+    return out
+}
+
+// 获取缓存数据库
+func (m *BECache) CacheDB() cachedb.ICacheDB {
+    return m.cdb
+}
+
+// 获取本地缓存数据库, 没有开启本地缓存时为 nocache
+func (m *BECache) LocalCacheDB() cachedb.ICacheDB {
+    return m.local_cdb
+}
+
 // 获取加载器
 func (m *BECache) getLoader(space string) ILoader {
     m.mx.RLock()
@@ -123,83 +190,239 @@ func (m *BECache) getLoader(space string) ILoader {
     return s
 }
 
-func (m *BECache) cacheGet(query *Query, a interface{}) (interface{}, error) {
-    out, err := m.local_cdb.Get(query, a)
-    if err == nil || err == NoEntry {
-        return out, err
+func (m *BECache) cacheGet(ctx context.Context, query *Query, a interface{}, loader ILoader) (interface{}, ServedFrom, error) {
+    sctx, span := m.startSpan(ctx, SpanLocalGet, query)
+    out, err := cdbGet(sctx, m.local_cdb, query, a)
+    endSpan(span, err)
+    if err == nil {
+        m.stats.incr(query.Space(), localHits)
+        return out, ServedFromLocal, nil
+    }
+    if err == NoEntry {
+        m.stats.incr(query.Space(), noEntryHits)
+        return nil, ServedFromLocal, NoEntry
     }
 
-    out, err = m.cdb.Get(query, a)
+    sctx, span = m.startSpan(ctx, SpanRemoteGet, query)
+    setCodecAttr(span, m.cdb)
+    out, err = cdbGet(sctx, m.cdb, query, a)
+    endSpan(span, err)
     if err == nil {
-        _ = m.local_cdb.Set(query, out, m.local_cdb_ex)
-        return out, nil
+        expired, stale := m.checkTTL(ctx, query, loader)
+        if expired {
+            return out, ServedFromStale, errExpiredEntry
+        }
+
+        m.stats.incr(query.Space(), cacheHits)
+        _ = cdbSet(ctx, m.local_cdb, query, out, m.local_cdb_ex)
+        if stale {
+            m.refresh(ctx, query, loader)
+        }
+        return out, ServedFromCacheDB, nil
     }
     if err == NoEntry {
-        _ = m.local_cdb.Set(query, NoEntry, m.local_cdb_ex)
-        return nil, NoEntry
+        m.stats.incr(query.Space(), noEntryHits)
+        _ = cdbSet(ctx, m.local_cdb, query, NoEntry, m.local_cdb_ex)
+        return nil, ServedFromCacheDB, NoEntry
     }
     if err == ErrNoEntry {
-        return nil, ErrNoEntry
+        return nil, "", ErrNoEntry
     }
-    return nil, zerrors.WithMessage(err, "缓存加载失败")
+    return nil, "", zerrors.WithMessage(err, "缓存加载失败")
 }
-func (m *BECache) cacheSet(query *Query, a interface{}, loader ILoader) {
-    _ = m.local_cdb.Set(query, a, m.local_cdb_ex)
+func (m *BECache) cacheSet(ctx context.Context, query *Query, a interface{}, loader ILoader) {
+    ctx, span := m.startSpan(ctx, SpanWriteBack, query)
+    _, err := m.intercept(ctx, StageSet, query, func(ctx context.Context, query *Query) (interface{}, error) {
+        _ = cdbSet(ctx, m.local_cdb, query, a, m.local_cdb_ex)
+        tags := loaderTags(query, a, loader)
+        _ = addTags(ctx, m.local_cdb, query, tags, m.local_cdb_ex)
+
+        var ex time.Duration
+        if a == NoEntry {
+            if !m.cache_no_entry {
+                return a, nil
+            }
+            ex = m.cache_no_entry_ex
+        } else {
+            ex = loader.Expire()
+            if ex == -1 {
+                ex = makeExpire(m.default_ex, m.default_endex)
+            }
+            if ex > 0 {
+                ex += m.staleExpire(loader)
+            }
+        }
 
-    var ex time.Duration
-    if a == NoEntry {
-        if !m.cache_no_entry {
-            return
+        if e := cdbSet(ctx, m.cdb, query, a, ex); e != nil {
+            m.stats.incr(query.Space(), cacheSetErrors)
+            m.log.Warn(zerrors.WithMessagef(e, "缓存失败<%s>", query.FullPath()))
+            return a, e
         }
-        ex = m.cache_no_entry_ex
-    } else {
-        ex = loader.Expire()
-        if ex == -1 {
-            ex = makeExpire(m.default_ex, m.default_endex)
+        if e := addTags(ctx, m.cdb, query, tags, ex); e != nil {
+            m.log.Warn(zerrors.WithMessagef(e, "添加标签失败<%s>", query.FullPath()))
         }
-    }
-
-    if e := m.cdb.Set(query, a, ex); e != nil {
-        m.log.Warn(zerrors.WithMessagef(e, "缓存失败<%s>", query.FullPath()))
-    }
+        return a, nil
+    })
+    endSpan(span, err)
 }
-func (m *BECache) cacheDel(query *Query) error {
-    err := m.cdb.Del(query)
-    _ = m.local_cdb.Del(query)
+func (m *BECache) cacheDel(ctx context.Context, query *Query) error {
+    _, err := m.intercept(ctx, StageDel, query, func(ctx context.Context, query *Query) (interface{}, error) {
+        err := cdbDel(ctx, m.cdb, query)
+        _ = cdbDel(ctx, m.local_cdb, query)
+        m.publish(ctx, &cachedb.InvalidationEvent{Op: cachedb.InvalidateDel, Space: query.Space(), Params: query.Params()})
+        return nil, err
+    })
     return err
 }
-func (m *BECache) cacheDelSpace(space string) error {
-    err := m.cdb.DelSpaceData(space)
-    _ = m.local_cdb.DelSpaceData(space)
+func (m *BECache) cacheDelSpace(ctx context.Context, space string) error {
+    _, err := m.intercept(ctx, StageDelSpace, NewQuery(space), func(ctx context.Context, query *Query) (interface{}, error) {
+        err := cdbDelSpaceData(ctx, m.cdb, query.Space())
+        _ = cdbDelSpaceData(ctx, m.local_cdb, query.Space())
+        m.publish(ctx, &cachedb.InvalidationEvent{Op: cachedb.InvalidateDelSpace, Space: query.Space()})
+        return nil, err
+    })
     return err
 }
 
+// 获取过期数据保留时间
+func (m *BECache) staleExpire(loader ILoader) time.Duration {
+    if sloader, ok := loader.(IServeStaleLoader); ok {
+        if ex := sloader.ServeStaleOnError(); ex != -1 {
+            return ex
+        }
+    }
+    return m.stale_ex
+}
+
+// 根据剩余有效时间检查缓存数据库中数据的状态
+// expired 表示数据已过期, 仅作为db加载失败时的备用数据保留; stale 表示数据超过了加载器的软过期时间
+func (m *BECache) checkTTL(ctx context.Context, query *Query, loader ILoader) (expired, stale bool) {
+    stale_ex := m.staleExpire(loader)
+
+    var soft, base time.Duration
+    if sloader, ok := loader.(ISoftExpireLoader); ok {
+        soft, base = sloader.SoftExpire()
+        if base == -1 {
+            base = m.default_ex
+        }
+    }
+    check_soft := soft > 0 && base > 0
+
+    if stale_ex <= 0 && !check_soft {
+        return false, false
+    }
+
+    tcdb, ok := m.cdb.(cachedb.ITTLCacheDB)
+    if !ok {
+        return false, false
+    }
+    ttl, err := cdbTTL(ctx, tcdb, query)
+    if err != nil || ttl < 0 {
+        return false, false
+    }
+
+    if stale_ex > 0 {
+        if ttl <= stale_ex {
+            return true, false
+        }
+        ttl -= stale_ex
+    }
+    return false, check_soft && ttl <= base-soft
+}
+
+// 在后台从db重新加载数据, 同一个key同时只会有一个刷新任务
+// 后台任务会保留ctx中的值, 但是不会因为ctx被取消而中断
+func (m *BECache) refresh(ctx context.Context, query *Query, loader ILoader) {
+    key := query.FullPath()
+    if _, loaded := m.refreshing.LoadOrStore(key, struct{}{}); loaded {
+        return
+    }
+
+    if err := m.beginLoad(); err != nil {
+        m.refreshing.Delete(key)
+        return
+    }
+
+    ctx = detachContext(ctx)
+    go func() {
+        defer m.endLoad()
+        defer m.refreshing.Delete(key)
+        if _, err := m.loadDB(ctx, query, loader, false); err != nil && err != ErrNoEntry {
+            m.log.Warn(zerrors.WithMessagef(err, "后台刷新失败<%s>", key))
+        }
+    }()
+}
+
 // 从db加载
-func (m *BECache) loadDB(query *Query, loader ILoader, delCacheOnErr bool) (interface{}, error) {
+func (m *BECache) loadDB(ctx context.Context, query *Query, loader ILoader, delCacheOnErr bool) (interface{}, error) {
     if loader == nil {
         return nil, zerrors.NewSimplef("<%s>加载器为nil", query.Space())
     }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if m.bloomReject(ctx, query) {
+        return m.saveLoadResult(ctx, query, loader, nil, ErrNoEntry)
+    }
+
+    sctx, span := m.startSpan(ctx, SpanLoad, query)
+    a, err := m.intercept(sctx, StageLoad, query, func(ctx context.Context, query *Query) (a interface{}, err error) {
+        lerr := m.limit(ctx, query.Space(), loader, func(ctx context.Context) error {
+            a, err = m.circuit(ctx, loader, func(ctx context.Context) (interface{}, error) {
+                return callLoader(ctx, loader, func(ctx context.Context) (interface{}, error) {
+                    release, err := holdLimitSlot(ctx)
+                    if err != nil {
+                        return nil, err
+                    }
+                    defer release()
+
+                    start := time.Now()
+                    a, err := loaderLoad(ctx, loader, query)
+                    m.stats.load(query.Space(), time.Since(start), err)
+                    return a, err
+                })
+            })
+            return nil
+        })
+        if lerr != nil {
+            return nil, lerr
+        }
+        return a, err
+    })
+    endSpan(span, err)
 
-    a, err := loader.Load(query)
+    // 降级函数返回的数据不写入缓存
+    if fallback, ok := circuitFallback(loader, err); ok {
+        out, ferr := fallback(ctx, query, err)
+        if ferr != nil && ferr != ErrNoEntry {
+            return nil, zerrors.WithMessage(ferr, "db加载失败")
+        }
+        return out, ferr
+    }
 
+    if err != nil && err != ErrNoEntry && delCacheOnErr {
+        if e := cdbDel(ctx, m.cdb, query); e != nil { // 从db加载失败时从缓存删除
+            m.log.Warn(zerrors.WithMessagef(e, "db加载失败后删除缓存失败<%s>", query.FullPath()))
+        }
+    }
+    return m.saveLoadResult(ctx, query, loader, a, err)
+}
+
+// 处理db加载结果, 加载成功或条目不存在时写入缓存
+func (m *BECache) saveLoadResult(ctx context.Context, query *Query, loader ILoader, a interface{}, err error) (interface{}, error) {
     if err == nil {
         if a == nil {
             return nil, zerrors.New("db加载结果不能为nil")
         }
-        m.cacheSet(query, a, loader)
+        m.cacheSet(ctx, query, a, loader)
         return a, nil
     }
 
     if err == ErrNoEntry {
-        m.cacheSet(query, NoEntry, loader)
+        m.cacheSet(ctx, query, NoEntry, loader)
         return nil, ErrNoEntry
     }
 
-    if delCacheOnErr {
-        if e := m.cdb.Del(query); e != nil { // 从db加载失败时从缓存删除
-            m.log.Warn(zerrors.WithMessagef(e, "db加载失败后删除缓存失败<%s>", query.FullPath()))
-        }
-    }
     return nil, zerrors.WithMessage(err, "db加载失败")
 }
 
@@ -215,10 +438,24 @@ func (m *BECache) GetWithContext(ctx context.Context, query *Query, a interface{
 }
 
 // 获取数据, 缓存数据不存在时使用指定加载器获取数据
+// ctx 的值会传递给支持上下文的缓存数据库和加载器, 同一个key的并发请求共享一次加载
+// 共享的加载不会因为某个请求的ctx被取消而中断, 超时时间通过 WithSharedLoadTimeout 设置, 每个请求的ctx被取消时会立即返回ctx的错误
 func (m *BECache) GetWithLoader(ctx context.Context, query *Query, a interface{}, loader ILoader) (err error) {
-    return doFnWithContext(ctx, func() error {
-        return m.getWithLoader(query, a, loader)
+    ctx = makeContext(ctx)
+    if err = ctx.Err(); err != nil {
+        return err
+    }
+
+    ctx, span := m.startSpan(ctx, SpanGet, query)
+    _, err = m.intercept(ctx, StageGet, query, func(ctx context.Context, query *Query) (interface{}, error) {
+        from, err := m.getWithLoader(ctx, query, a, loader)
+        if from != "" {
+            span.SetAttribute(AttrServedFrom, string(from))
+        }
+        return a, err
     })
+    endSpan(span, err)
+    return err
 }
 
 // 获取数据, 缓存数据不存在时使用指定加载函数获取数据
@@ -226,83 +463,173 @@ func (m *BECache) GetWithLoaderFn(ctx context.Context, query *Query, a interface
     return m.GetWithLoader(ctx, query, a, NewLoader(fn))
 }
 
-func (m *BECache) getWithLoader(query *Query, a interface{}, loader ILoader) error {
+func (m *BECache) getWithLoader(ctx context.Context, query *Query, a interface{}, loader ILoader) (ServedFrom, error) {
+    ctx, span := m.startSpan(ctx, SpanSingleFlight, query)
+
     // 同时只能有一个goroutine在获取数据,其它goroutine直接等待结果
-    out, err := m.sf.Do(query.FullPath(), func() (interface{}, error) {
-        out, err := m.query(query, a, loader)
-        if err != nil {
-            return nil, err
-        }
-        if out == nil {
-            return nil, nil
-        }
+    var (
+        executed bool
+        from     = ServedFromShared
+        out      interface{}
+        err      error
+    )
+    elemType := reflect.TypeOf(a).Elem()
+    do := func() {
+        sctx, cancel := m.sharedContext(ctx)
+        defer cancel()
+        out, err = m.sf.Do(query.FullPath(), func() (interface{}, error) {
+            executed = true
+            // 使用新的变量接收数据, 调用者放弃等待后不会再写入a
+            out, f, err := m.query(sctx, query, reflect.New(elemType).Interface(), loader)
+            from = f
+            if out == nil {
+                return nil, err
+            }
 
-        if m.deepcopy_result {
-            var buf bytes.Buffer
-            err = msgpack.NewEncoder(&buf).Encode(out)
-            return buf.Bytes(), err
+            if m.deepcopy_result {
+                var buf bytes.Buffer
+                if e := msgpack.NewEncoder(&buf).Encode(out); e != nil {
+                    return nil, e
+                }
+                return buf.Bytes(), err
+            }
+            return reflect.Indirect(reflect.ValueOf(out)), err
+        })
+    }
+
+    if ctx.Done() == nil {
+        do()
+    } else {
+        done := make(chan struct{})
+        go func() {
+            defer close(done)
+            do()
+        }()
+        select {
+        case <-done:
+        case <-ctx.Done():
+            endSpan(span, ctx.Err())
+            return "", ctx.Err()
         }
-        return reflect.Indirect(reflect.ValueOf(out)), err
-    })
+    }
 
-    if err != nil {
+    if !executed {
+        m.stats.incr(query.Space(), sharedWaits)
+    }
+    span.SetAttribute(AttrShared, !executed)
+    endSpan(span, err)
+
+    // 返回过期数据时仍然需要将数据写入a
+    if err != nil && zerrors.Cause(err) != ErrStaleData {
         if err == NoEntry {
             err = ErrNoEntry
         }
-        return zerrors.WithMessagef(err, "加载失败<%s>", query.FullPath())
+        return from, zerrors.WithMessagef(err, "加载失败<%s>", query.FullPath())
     }
 
     if out == nil {
-        return errors.New("未对nil数据做处理")
+        return from, errors.New("未对nil数据做处理")
     }
 
     if m.deepcopy_result {
-        return msgpack.NewDecoder(bytes.NewReader(out.([]byte))).Decode(a)
+        if e := msgpack.NewDecoder(bytes.NewReader(out.([]byte))).Decode(a); e != nil {
+            return from, e
+        }
+    } else {
+        reflect.ValueOf(a).Elem().Set(out.(reflect.Value))
     }
 
-    reflect.ValueOf(a).Elem().Set(out.(reflect.Value))
-    return nil
+    if err != nil {
+        return from, zerrors.WithMessagef(err, "加载失败<%s>", query.FullPath())
+    }
+    return from, nil
 }
 
-func (m *BECache) query(query *Query, a interface{}, loader ILoader) (interface{}, error) {
-    out, gerr := m.cacheGet(query, a)
+func (m *BECache) query(ctx context.Context, query *Query, a interface{}, loader ILoader) (interface{}, ServedFrom, error) {
+    out, from, gerr := m.cacheGet(ctx, query, a, loader)
     if gerr == nil || gerr == NoEntry {
-        return out, gerr
+        return out, from, gerr
+    }
+
+    var expired interface{}
+    if gerr == errExpiredEntry {
+        expired, gerr = out, ErrNoEntry
     }
 
-    out, lerr := m.loadDB(query, loader, false)
-    if lerr == nil {
-        return out, lerr
+    out, from, lerr := m.loadOnce(ctx, query, a, loader)
+    if lerr == nil || lerr == ErrNoEntry {
+        return out, from, lerr
+    }
+
+    // db加载失败时返回过期数据, 加载器过载时根据加载器的设置决定是否返回过期数据
+    if expired != nil && (zerrors.Cause(lerr) != ErrLoaderOverloaded || m.overloadServeStale(query.Space())) {
+        m.log.Warn(zerrors.WithMessagef(lerr, "返回过期数据<%s>", query.FullPath()))
+        return expired, ServedFromStale, zerrors.WithMessage(ErrStaleData, lerr.Error())
     }
 
     if gerr != ErrNoEntry { // 有效的错误
-        return nil, zerrors.WithMessage(gerr, lerr.Error())
+        return nil, "", zerrors.WithMessage(gerr, lerr.Error())
+    }
+    return nil, "", lerr
+}
+
+// 调用加载器, 单飞模块支持跨进程控制加载时其它进程会等待加载结果写入缓存
+func (m *BECache) loadOnce(ctx context.Context, query *Query, a interface{}, loader ILoader) (interface{}, ServedFrom, error) {
+    if err := m.beginLoad(); err != nil {
+        return nil, "", err
+    }
+    defer m.endLoad()
+
+    lsf, ok := m.sf.(ILoadSingleFlight)
+    if !ok {
+        out, err := m.loadDB(ctx, query, loader, false)
+        return out, ServedFromLoader, err
     }
-    return nil, lerr
+
+    from := ServedFromLoader
+    out, err := lsf.DoLoad(ctx, query.FullPath(), func() (interface{}, error) {
+        return m.loadDB(ctx, query, loader, false)
+    }, func() (interface{}, bool, error) {
+        out, f, err := m.cacheGet(ctx, query, a, loader)
+        switch err {
+        case nil:
+            from = f
+            return out, true, nil
+        case NoEntry:
+            from = f
+            return nil, true, ErrNoEntry
+        }
+        return nil, false, nil
+    })
+    return out, from, err
 }
 
 // 删除指定数据
 func (m *BECache) DelData(query *Query) error {
-    return m.cacheDel(query)
+    return m.DelDataWithContext(nil, query)
 }
 
 // 删除指定数据
 func (m *BECache) DelDataWithContext(ctx context.Context, query *Query) (err error) {
-    return doFnWithContext(ctx, func() error {
-        return m.cacheDel(query)
-    })
+    ctx = makeContext(ctx)
+    if err = ctx.Err(); err != nil {
+        return err
+    }
+    return m.cacheDel(ctx, query)
 }
 
 // 删除空间数据
 func (m *BECache) DelSpaceData(space string) error {
-    return m.cacheDelSpace(space)
+    return m.DelSpaceDataWithContext(nil, space)
 }
 
-// 删除空间数据
+// 删除空间数据, 缓存数据库实现 cachedb.IContextSpaceCacheDB 时会传入ctx
 func (m *BECache) DelSpaceDataWithContext(ctx context.Context, space string) error {
-    return doFnWithContext(ctx, func() error {
-        return m.cacheDelSpace(space)
-    })
+    ctx = makeContext(ctx)
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    return m.cacheDelSpace(ctx, space)
 }
 
 // 设置数据到缓存
@@ -312,48 +639,55 @@ func (m *BECache) Set(query *Query, a interface{}, ex ...time.Duration) error {
 
 // 设置数据到缓存
 func (m *BECache) SetWithContext(ctx context.Context, query *Query, a interface{}, ex ...time.Duration) error {
-    return doFnWithContext(ctx, func() error {
-        var expire = time.Duration(-1)
-        if len(ex) > 0 {
-            expire = ex[0]
-        }
+    return m.SetWithTags(ctx, query, a, nil, ex...)
+}
+
+// 设置数据到缓存并添加标签, 可以通过 InvalidateTag 删除标签关联的所有数据
+func (m *BECache) SetWithTags(ctx context.Context, query *Query, a interface{}, tags []string, ex ...time.Duration) error {
+    ctx = makeContext(ctx)
+    if err := ctx.Err(); err != nil {
+        return err
+    }
 
+    var expire = time.Duration(-1)
+    if len(ex) > 0 {
+        expire = ex[0]
+    }
+
+    _, err := m.intercept(ctx, StageSet, query, func(ctx context.Context, query *Query) (interface{}, error) {
+        expire := expire
         if a == NoEntry {
             if !m.cache_no_entry {
-                _ = m.local_cdb.Set(query, a, m.local_cdb_ex)
-                return nil
+                _ = cdbSet(ctx, m.local_cdb, query, a, m.local_cdb_ex)
+                _ = addTags(ctx, m.local_cdb, query, tags, m.local_cdb_ex)
+                return a, nil
             }
             expire = m.cache_no_entry_ex
-        } else if expire == -1 {
-            expire = makeExpire(m.default_ex, m.default_endex)
+        } else {
+            if expire == -1 {
+                expire = makeExpire(m.default_ex, m.default_endex)
+            }
+            if expire > 0 {
+                expire += m.staleExpire(m.getLoader(query.Space()))
+            }
         }
 
-        if e := m.cdb.Set(query, a, expire); e != nil {
-            return zerrors.WithMessagef(e, "缓存失败<%s>", query.FullPath())
+        if e := cdbSet(ctx, m.cdb, query, a, expire); e != nil {
+            m.stats.incr(query.Space(), cacheSetErrors)
+            return a, zerrors.WithMessagef(e, "缓存失败<%s>", query.FullPath())
+        }
+        if e := addTags(ctx, m.cdb, query, tags, expire); e != nil {
+            return a, zerrors.WithMessagef(e, "添加标签失败<%s>", query.FullPath())
         }
-        _ = m.local_cdb.Set(query, a, m.local_cdb_ex)
-        return nil
+        _ = cdbSet(ctx, m.local_cdb, query, a, m.local_cdb_ex)
+        _ = addTags(ctx, m.local_cdb, query, tags, m.local_cdb_ex)
+        m.publish(ctx, &cachedb.InvalidationEvent{Op: cachedb.InvalidateSet, Space: query.Space(), Params: query.Params()})
+        if a != NoEntry {
+            m.bloomAdd(ctx, query)
+        }
+        return a, nil
     })
-}
-
-// 为一个函数添加ctx
-func doFnWithContext(ctx context.Context, fn func() error) (err error) {
-    if ctx == nil || ctx == context.Background() || ctx == context.TODO() {
-        return fn()
-    }
-
-    done := make(chan struct{})
-    go func() {
-        err = fn()
-        done <- struct{}{}
-    }()
-
-    select {
-    case <-done:
-        return err
-    case <-ctx.Done():
-        return ctx.Err()
-    }
+    return err
 }
 
 func makeExpire(ex, endex time.Duration) time.Duration {
@@ -0,0 +1,142 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  布隆过滤器
+-------------------------------------------------
+*/
+
+package bloom
+
+import (
+    "context"
+    "math"
+    "sync"
+)
+
+// 布隆过滤器, 用于判断key是否一定不存在
+type IFilter interface {
+    // 添加key
+    Add(ctx context.Context, keys ...string) error
+    // 判断key是否可能存在, 返回false表示一定不存在, 过滤器还没有添加过key时应该返回true
+    Test(ctx context.Context, key string) (bool, error)
+    // 重建过滤器, fill 中添加的key会写入新的过滤器, 完成后替换旧的过滤器
+    // 重建期间旧的过滤器仍然可用, 通过 Add 添加的key会同时写入新的过滤器
+    Rebuild(ctx context.Context, fill func(add func(keys ...string) error) error) error
+}
+
+// 根据预计的key数量和误判率计算位数和哈希函数数量
+func Estimate(n uint64, fp float64) (m uint64, k uint) {
+    if n == 0 {
+        n = 1
+    }
+    if fp <= 0 || fp >= 1 {
+        fp = 0.01
+    }
+    m = uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+    k = uint(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+    if k < 1 {
+        k = 1
+    }
+    return m, k
+}
+
+// 计算key在过滤器中的k个位置, m 为总位数
+//
+// 使用 fnv-1a 的64位哈希值拆分为两个32位哈希值做双重哈希
+func Locations(key string, k uint, m uint64) []uint64 {
+    h := uint64(14695981039346656037)
+    for i := 0; i < len(key); i++ {
+        h ^= uint64(key[i])
+        h *= 1099511628211
+    }
+    h1, h2 := h&math.MaxUint32, h>>32
+
+    out := make([]uint64, k)
+    for i := uint(0); i < k; i++ {
+        out[i] = (h1 + uint64(i)*h2) % m
+    }
+    return out
+}
+
+var _ IFilter = (*Filter)(nil)
+
+// 内存中的布隆过滤器
+type Filter struct {
+    bits    []uint64
+    pending []uint64 // 重建中的新过滤器
+    built   bool     // 是否添加过key
+    m       uint64
+    k       uint
+    mx      sync.RWMutex
+
+    rebuild_mx sync.Mutex
+}
+
+// 创建一个内存中的布隆过滤器, n 为预计的key数量, fp 为误判率
+func New(n uint64, fp float64) *Filter {
+    m, k := Estimate(n, fp)
+    return &Filter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (f *Filter) Add(_ context.Context, keys ...string) error {
+    f.mx.Lock()
+    for _, key := range keys {
+        locs := Locations(key, f.k, f.m)
+        setBits(f.bits, locs)
+        if f.pending != nil {
+            setBits(f.pending, locs)
+        }
+    }
+    f.built = true
+    f.mx.Unlock()
+    return nil
+}
+
+func (f *Filter) Test(_ context.Context, key string) (bool, error) {
+    locs := Locations(key, f.k, f.m)
+
+    f.mx.RLock()
+    defer f.mx.RUnlock()
+    if !f.built {
+        return true, nil
+    }
+    for _, loc := range locs {
+        if f.bits[loc/64]&(1<<(loc%64)) == 0 {
+            return false, nil
+        }
+    }
+    return true, nil
+}
+
+func (f *Filter) Rebuild(_ context.Context, fill func(add func(keys ...string) error) error) error {
+    f.rebuild_mx.Lock()
+    defer f.rebuild_mx.Unlock()
+
+    f.mx.Lock()
+    f.pending = make([]uint64, len(f.bits))
+    f.mx.Unlock()
+
+    err := fill(func(keys ...string) error {
+        f.mx.Lock()
+        for _, key := range keys {
+            setBits(f.pending, Locations(key, f.k, f.m))
+        }
+        f.mx.Unlock()
+        return nil
+    })
+
+    f.mx.Lock()
+    if err == nil {
+        f.bits, f.built = f.pending, true
+    }
+    f.pending = nil
+    f.mx.Unlock()
+    return err
+}
+
+func setBits(bits []uint64, locs []uint64) {
+    for _, loc := range locs {
+        bits[loc/64] |= 1 << (loc % 64)
+    }
+}
@@ -0,0 +1,93 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  布隆过滤器防止缓存穿透
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/bloom"
+)
+
+// 获取空间的布隆过滤器
+func (m *BECache) getFilter(space string) bloom.IFilter {
+    m.mx.RLock()
+    f := m.filters[space]
+    m.mx.RUnlock()
+    return f
+}
+
+// 布隆过滤器判断条目一定不存在时返回true, 过滤器出错时认为条目可能存在
+func (m *BECache) bloomReject(ctx context.Context, query *Query) bool {
+    f := m.getFilter(query.Space())
+    if f == nil {
+        return false
+    }
+
+    ok, err := f.Test(ctx, query.FullPath())
+    if err != nil {
+        m.log.Warn(zerrors.WithMessagef(err, "布隆过滤器检查失败<%s>", query.FullPath()))
+        return false
+    }
+    return !ok
+}
+
+// 将key添加到布隆过滤器, 失败时只记录日志
+func (m *BECache) bloomAdd(ctx context.Context, query *Query) {
+    f := m.getFilter(query.Space())
+    if f == nil {
+        return
+    }
+    if err := f.Add(ctx, query.FullPath()); err != nil {
+        m.log.Warn(zerrors.WithMessagef(err, "添加到布隆过滤器失败<%s>", query.FullPath()))
+    }
+}
+
+// 将key添加到对应空间的布隆过滤器, 在db中新增数据后应该调用, 否则新数据会被判断为不存在
+// 通过 Set 设置的数据会自动添加
+func (m *BECache) AddBloomKeys(ctx context.Context, queries ...*Query) error {
+    ctx = makeContext(ctx)
+    for _, query := range queries {
+        f := m.getFilter(query.Space())
+        if f == nil {
+            continue
+        }
+        if err := f.Add(ctx, query.FullPath()); err != nil {
+            return zerrors.WithMessagef(err, "添加到布隆过滤器失败<%s>", query.FullPath())
+        }
+    }
+    return nil
+}
+
+// 通过加载器枚举的key重建空间的布隆过滤器, 加载器需要实现 IKeysLoader
+func (m *BECache) RebuildBloomFilter(ctx context.Context, space string) error {
+    ctx = makeContext(ctx)
+    f := m.getFilter(space)
+    if f == nil {
+        return zerrors.NewSimplef("<%s>没有设置布隆过滤器", space)
+    }
+    kloader, ok := m.getLoader(space).(IKeysLoader)
+    if !ok {
+        return zerrors.NewSimplef("<%s>加载器不支持枚举key", space)
+    }
+
+    err := f.Rebuild(ctx, func(add func(keys ...string) error) error {
+        return kloader.RangeKeys(ctx, func(query *Query) error {
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            return add(query.FullPath())
+        })
+    })
+    if err != nil {
+        return zerrors.WithMessagef(err, "重建布隆过滤器失败<%s>", space)
+    }
+    return nil
+}
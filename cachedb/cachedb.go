@@ -9,12 +9,19 @@
 package cachedb
 
 import (
+    "context"
     "time"
 
+    "github.com/zlyuancn/zbec/codec"
     "github.com/zlyuancn/zbec/query"
 )
 
+// 缓存数据库调用观察者, op 为操作名, latency 为调用耗时, err 为调用返回的错误
+type Observer func(op string, latency time.Duration, err error)
+
 // 缓存数据库接口
+//
+// 持有连接或后台goroutine的缓存数据库应该实现 io.Closer, BECache.Shutdown 时会调用 Close
 type ICacheDB interface {
     // 设置一个值, ex 为 0 时不应该有过期时间
     // 实现缓存数据库接口的结构应该主动考虑 v 值为 nil(空数据) 如何保存才能在获取时判断它是 NilData
@@ -27,3 +34,139 @@ type ICacheDB interface {
     // 删除空间数据
     DelSpaceData(space string) error
 }
+
+// 支持批量获取的缓存数据库接口
+type IBatchCacheDB interface {
+    ICacheDB
+    // 批量获取值, as 与 queries 一一对应, 用于接收每个 query 的结果
+    // 返回的结果和错误与 queries 一一对应, 每个条目的错误规则与 Get 相同
+    MGet(queries []*query.Query, as []interface{}) ([]interface{}, []error)
+}
+
+// 支持获取剩余有效时间的缓存数据库接口
+type ITTLCacheDB interface {
+    ICacheDB
+    // 获取剩余有效时间, 永不过期应该返回 -1, 不存在应该返回 ErrNoEntry
+    TTL(query *query.Query) (time.Duration, error)
+}
+
+// 支持上下文的缓存数据库接口, BECache会优先使用带上下文的方法
+type IContextCacheDB interface {
+    ICacheDB
+    // 设置一个值, 规则与 Set 相同
+    SetContext(ctx context.Context, query *query.Query, v interface{}, ex time.Duration) error
+    // 获取一个值, 规则与 Get 相同
+    GetContext(ctx context.Context, query *query.Query, a interface{}) (interface{}, error)
+    // 删除一个key
+    DelContext(ctx context.Context, query *query.Query) error
+}
+
+// 支持上下文的批量获取缓存数据库接口, BECache会优先使用带上下文的方法
+type IContextBatchCacheDB interface {
+    IBatchCacheDB
+    // 批量获取值, 规则与 MGet 相同
+    MGetContext(ctx context.Context, queries []*query.Query, as []interface{}) ([]interface{}, []error)
+}
+
+// 支持上下文的获取剩余有效时间的缓存数据库接口, BECache会优先使用带上下文的方法
+type IContextTTLCacheDB interface {
+    ITTLCacheDB
+    // 获取剩余有效时间, 规则与 TTL 相同
+    TTLContext(ctx context.Context, query *query.Query) (time.Duration, error)
+}
+
+// 支持上下文删除空间数据的缓存数据库接口, BECache会优先使用带上下文的方法
+type IContextSpaceCacheDB interface {
+    ICacheDB
+    // 删除空间数据
+    DelSpaceDataContext(ctx context.Context, space string) error
+}
+
+// 可以获取编解码器类型的缓存数据库接口
+type ICodecCacheDB interface {
+    ICacheDB
+    // 获取编解码器类型
+    CodecType() codec.CodecType
+}
+
+// 可以获取数据实际key的缓存数据库接口, 用于调试
+type IKeyCacheDB interface {
+    ICacheDB
+    // 获取query在缓存数据库中的key
+    CacheKey(query *query.Query) (string, error)
+}
+
+// 可以清除所有数据的缓存数据库接口, 本地缓存实现后失效总线重新连接时可以清除所有空间的数据
+type IClearCacheDB interface {
+    ICacheDB
+    // 清除所有空间的数据
+    Clear() error
+}
+
+// 支持查看数据而不影响淘汰顺序的缓存数据库接口, 用于调试
+type IPeekCacheDB interface {
+    ICacheDB
+    // 获取一个值, 规则与 Get 相同, 但是不会更新数据的最近使用时间和访问频率
+    Peek(query *query.Query, a interface{}) (interface{}, error)
+}
+
+// 由多层缓存数据库组合的缓存数据库接口
+type ITieredCacheDB interface {
+    ICacheDB
+    // 获取所有层, 按查找顺序从上到下排列
+    Tiers() []ICacheDB
+}
+
+// 支持标签的缓存数据库接口, 可以通过标签删除多个空间的数据
+type ITagCacheDB interface {
+    ICacheDB
+    // 为数据添加标签, ex 为数据的有效时间, 标签索引至少要保留这么久, ex 小于等于 0 表示永不过期
+    AddTags(query *query.Query, tags []string, ex time.Duration) error
+    // 删除标签关联的所有数据和标签索引
+    DelTag(tag string) error
+}
+
+// 支持上下文的标签缓存数据库接口, BECache会优先使用带上下文的方法
+type IContextTagCacheDB interface {
+    ITagCacheDB
+    // 为数据添加标签, 规则与 AddTags 相同
+    AddTagsContext(ctx context.Context, query *query.Query, tags []string, ex time.Duration) error
+    // 删除标签关联的所有数据和标签索引
+    DelTagContext(ctx context.Context, tag string) error
+}
+
+// 失效事件的操作
+const (
+    // 删除数据
+    InvalidateDel = "del"
+    // 删除空间数据
+    InvalidateDelSpace = "del_space"
+    // 设置数据
+    InvalidateSet = "set"
+    // 删除标签关联的数据
+    InvalidateTag = "del_tag"
+    // 可能丢失了事件, 应该清除所有本地缓存
+    InvalidateAll = "all"
+)
+
+// 本地缓存失效事件
+type InvalidationEvent struct {
+    // 操作
+    Op string `json:"op"`
+    // 空间名
+    Space string `json:"space,omitempty"`
+    // 参数
+    Params []string `json:"params,omitempty"`
+    // 标签
+    Tag string `json:"tag,omitempty"`
+    // 发布者id, 由总线设置
+    Source string `json:"source,omitempty"`
+}
+
+// 本地缓存失效总线, 用于在多个进程之间同步删除本地缓存
+type IInvalidationBus interface {
+    // 发布失效事件
+    Publish(ctx context.Context, event *InvalidationEvent) error
+    // 订阅失效事件, 收到事件时会调用 handler, 只能订阅一次
+    Subscribe(handler func(event *InvalidationEvent)) error
+}
@@ -9,19 +9,29 @@
 package go_cache
 
 import (
+    "io"
+    "runtime"
     "sync"
     "time"
 
     "github.com/patrickmn/go-cache"
 
     "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/codec"
     "github.com/zlyuancn/zbec/errs"
     "github.com/zlyuancn/zbec/query"
 )
 
 const DefaultCleanupInterval = time.Minute * 5
 
-var _ cachedb.ICacheDB = (*goCache)(nil)
+var _ cachedb.ITTLCacheDB = (*goCache)(nil)
+var _ io.Closer = (*goCache)(nil)
+var _ cachedb.IClearCacheDB = (*goCache)(nil)
+
+// 返回给调用者的包装, 后台goroutine只引用内部的 goCache, 包装不再被引用时会自动停止后台goroutine
+type goCacheWrap struct {
+    *goCache
+}
 
 type goCache struct {
     cdbs map[string]*cache.Cache
@@ -29,17 +39,101 @@ type goCache struct {
 
     // 每隔一段时间后清理过期的key
     cleanupInterval time.Duration
+
+    tags  map[string]*tagIndex // 标签索引
+    tagMx sync.Mutex
+
+    done      chan struct{}
+    loops     sync.WaitGroup // 后台写入快照的goroutine
+    stopOnce  sync.Once
+    closeOnce sync.Once
+
+    // 写入和删除数据时加读锁, 替换从快照恢复的数据时加写锁, 避免覆盖并发写入的数据
+    writeMx sync.RWMutex
+
+    snapshot_path     string          // 快照文件
+    snapshot_interval time.Duration   // 后台写入快照的间隔
+    snapshot_codec    codec.ICodec    // 快照中数据的编解码器
+    on_snapshot_error func(err error) // 快照错误处理函数
 }
 
-func NewGoCache(cleanupInterval time.Duration) cachedb.ICacheDB {
+func NewGoCache(cleanupInterval time.Duration, opts ...Option) cachedb.ICacheDB {
     if cleanupInterval <= 0 {
         cleanupInterval = DefaultCleanupInterval
     }
     a := &goCache{
         cdbs:            make(map[string]*cache.Cache),
         cleanupInterval: cleanupInterval,
+        tags:            make(map[string]*tagIndex),
+        done:            make(chan struct{}),
+        snapshot_codec:  codec.GetCodec(codec.DefaultCodecType),
+    }
+    for _, o := range opts {
+        o(a)
+    }
+
+    if a.snapshot_path != "" {
+        if err := a.RestoreFile(a.snapshot_path); err != nil {
+            a.snapshotError(err)
+        }
+        if a.snapshot_interval > 0 {
+            a.loops.Add(1)
+            go a.snapshotLoop()
+        }
+    }
+    go a.janitor()
+
+    w := &goCacheWrap{a}
+    runtime.SetFinalizer(w, stopGoCache)
+    return w
+}
+
+// 包装被回收时停止后台goroutine
+func stopGoCache(w *goCacheWrap) {
+    w.stop()
+}
+
+// 每隔一段时间清理所有空间过期的key, 所有空间共用一个清理goroutine
+func (m *goCache) janitor() {
+    ticker := time.NewTicker(m.cleanupInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-m.done:
+            return
+        case <-ticker.C:
+        }
+
+        m.mx.RLock()
+        cs := make([]*cache.Cache, 0, len(m.cdbs))
+        for _, c := range m.cdbs {
+            cs = append(cs, c)
+        }
+        m.mx.RUnlock()
+
+        for _, c := range cs {
+            c.DeleteExpired()
+        }
     }
-    return a
+}
+
+// 停止清理过期的key和后台写入快照
+func (m *goCache) stop() {
+    m.stopOnce.Do(func() {
+        close(m.done)
+    })
+}
+
+// 停止清理过期的key和后台写入快照, 设置了快照文件时会等待正在写入的快照完成后写入最后一次快照, 关闭后仍然可以读写
+func (m *goCache) Close() (err error) {
+    m.closeOnce.Do(func() {
+        m.stop()
+        m.loops.Wait()
+        if m.snapshot_path != "" {
+            err = m.SnapshotFile(m.snapshot_path)
+        }
+    })
+    return err
 }
 
 func (m *goCache) getCache(name string) *cache.Cache {
@@ -57,7 +151,7 @@ func (m *goCache) getCache(name string) *cache.Cache {
         return c
     }
 
-    c = cache.New(0, m.cleanupInterval)
+    c = cache.New(0, 0)
     m.cdbs[name] = c
     m.mx.Unlock()
     return c
@@ -65,7 +159,9 @@ func (m *goCache) getCache(name string) *cache.Cache {
 
 func (m *goCache) Set(query *query.Query, v interface{}, ex time.Duration) error {
     c := m.getCache(query.Space())
+    m.writeMx.RLock()
     c.Set(query.Path(), v, ex)
+    m.writeMx.RUnlock()
     return nil
 }
 
@@ -86,9 +182,31 @@ func (m *goCache) Get(query *query.Query, a interface{}) (interface{}, error) {
     if out == errs.NoEntry {
         return nil, errs.NoEntry
     }
+    if v, ok := out.(*encodedValue); ok {
+        return m.decodeValue(c, query.Path(), v, a)
+    }
     return out, nil
 }
 
+func (m *goCache) TTL(query *query.Query) (time.Duration, error) {
+    m.mx.RLock()
+    c, ok := m.cdbs[query.Space()]
+    m.mx.RUnlock()
+
+    if !ok {
+        return 0, errs.ErrNoEntry
+    }
+
+    _, expiration, ok := c.GetWithExpiration(query.Path())
+    if !ok {
+        return 0, errs.ErrNoEntry
+    }
+    if expiration.IsZero() {
+        return -1, nil
+    }
+    return time.Until(expiration), nil
+}
+
 func (m *goCache) Del(query *query.Query) error {
     m.mx.RLock()
     c, ok := m.cdbs[query.Space()]
@@ -98,7 +216,9 @@ func (m *goCache) Del(query *query.Query) error {
         return nil
     }
 
+    m.writeMx.RLock()
     c.Delete(query.Path())
+    m.writeMx.RUnlock()
     return nil
 }
 
@@ -106,5 +226,18 @@ func (m *goCache) DelSpaceData(space string) error {
     m.mx.Lock()
     delete(m.cdbs, space)
     m.mx.Unlock()
+
+    m.delSpaceTags(space)
+    return nil
+}
+
+func (m *goCache) Clear() error {
+    m.mx.Lock()
+    m.cdbs = make(map[string]*cache.Cache)
+    m.mx.Unlock()
+
+    m.tagMx.Lock()
+    m.tags = make(map[string]*tagIndex)
+    m.tagMx.Unlock()
     return nil
 }
@@ -0,0 +1,40 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package go_cache
+
+import (
+    "time"
+
+    "github.com/zlyuancn/zbec/codec"
+)
+
+type Option func(m *goCache)
+
+// 设置快照文件, 创建时会从文件恢复数据, 关闭时会写入快照
+// interval 大于0时每隔 interval 在后台写入一次快照
+func WithSnapshot(path string, interval time.Duration) Option {
+    return func(m *goCache) {
+        m.snapshot_path = path
+        m.snapshot_interval = interval
+    }
+}
+
+// 设置快照中数据的编解码器, 默认为 codec.DefaultCodecType 对应的编解码器
+func WithSnapshotCodec(c codec.ICodec) Option {
+    return func(m *goCache) {
+        m.snapshot_codec = c
+    }
+}
+
+// 设置快照错误处理函数, 创建时恢复数据失败和后台写入快照失败的错误会交给这个函数
+func WithSnapshotErrorHandler(fn func(err error)) Option {
+    return func(m *goCache) {
+        m.on_snapshot_error = fn
+    }
+}
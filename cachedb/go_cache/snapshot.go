@@ -0,0 +1,309 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  快照
+-------------------------------------------------
+*/
+
+package go_cache
+
+import (
+    "bufio"
+    "encoding/binary"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "time"
+
+    "github.com/patrickmn/go-cache"
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/errs"
+)
+
+// 快照文件头
+const snapshotMagic = "ZBEC-SNAPSHOT-1\n"
+
+const (
+    snapshotValue   byte = iota // 数据
+    snapshotNoEntry             // 空条目
+)
+
+// 快照中单个字段的最大长度, 超过时认为快照已损坏
+const maxSnapshotFieldSize = 256 << 20
+
+var _ ISnapshotCacheDB = (*goCache)(nil)
+
+// 支持快照的缓存数据库
+type ISnapshotCacheDB interface {
+    // 将所有空间未过期的数据写入w, 不包括标签
+    Snapshot(w io.Writer) error
+    // 从r恢复数据, 已过期的数据会被忽略, 相同的key会被覆盖
+    Restore(r io.Reader) error
+    // 将快照写入文件
+    SnapshotFile(path string) error
+    // 从文件恢复数据
+    RestoreFile(path string) error
+}
+
+// 从快照恢复但还没有被获取的数据, 获取时才能知道数据的类型
+type encodedValue struct {
+    data []byte
+}
+
+// 将所有空间未过期的数据写入w, 数据通过快照编解码器编码, 保留剩余有效时间和空条目
+func (m *goCache) Snapshot(w io.Writer) error {
+    m.mx.RLock()
+    spaces := make(map[string]*cache.Cache, len(m.cdbs))
+    for name, c := range m.cdbs {
+        spaces[name] = c
+    }
+    m.mx.RUnlock()
+
+    bw := bufio.NewWriter(w)
+    if _, err := bw.WriteString(snapshotMagic); err != nil {
+        return zerrors.WithSimple(err)
+    }
+    for space, c := range spaces {
+        for path, item := range c.Items() {
+            kind, data := snapshotValue, []byte(nil)
+            switch v := item.Object.(type) {
+            case *encodedValue:
+                data = v.data
+            default:
+                if v == errs.NoEntry {
+                    kind = snapshotNoEntry
+                    break
+                }
+                bs, err := m.snapshot_codec.Encode(v)
+                if err != nil {
+                    return zerrors.WrapSimplef(err, "编码失败<%s:%s>", space, path)
+                }
+                data = bs
+            }
+
+            writeBytes(bw, []byte(space))
+            writeBytes(bw, []byte(path))
+            writeUvarint(bw, uint64(item.Expiration))
+            _ = bw.WriteByte(kind)
+            writeBytes(bw, data)
+        }
+    }
+    return zerrors.WithSimple(bw.Flush())
+}
+
+// 从r恢复数据, 数据在第一次获取时才会解码
+func (m *goCache) Restore(r io.Reader) error {
+    br := &snapshotReader{r: bufio.NewReader(r), remain: readerSize(r)}
+    magic := make([]byte, len(snapshotMagic))
+    if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+        return zerrors.NewSimple("不是有效的快照文件")
+    }
+
+    now := time.Now().UnixNano()
+    for {
+        space, err := readBytes(br)
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return zerrors.WrapSimple(err, "读取快照失败")
+        }
+
+        path, err := readBytes(br)
+        var expire uint64
+        if err == nil {
+            expire, err = binary.ReadUvarint(br)
+        }
+        var kind byte
+        if err == nil {
+            kind, err = br.ReadByte()
+        }
+        var data []byte
+        if err == nil {
+            data, err = readBytes(br)
+        }
+        if err != nil {
+            return zerrors.WrapSimple(noEOF(err), "读取快照失败")
+        }
+
+        ex := time.Duration(0)
+        if expire > 0 {
+            if ex = time.Duration(int64(expire) - now); ex <= 0 {
+                continue
+            }
+        }
+
+        var v interface{} = &encodedValue{data: data}
+        if kind == snapshotNoEntry {
+            v = errs.NoEntry
+        }
+        c := m.getCache(string(space))
+        m.writeMx.RLock()
+        c.Set(string(path), v, ex)
+        m.writeMx.RUnlock()
+    }
+}
+
+// 将快照写入文件, 先写入同一目录下的临时文件再替换, 写入失败不会损坏原来的快照, 同时写入时不会互相影响
+func (m *goCache) SnapshotFile(path string) error {
+    f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+    tmp := f.Name()
+    err = m.Snapshot(f)
+    if e := f.Close(); err == nil {
+        err = e
+    }
+    if err == nil {
+        err = os.Rename(tmp, path)
+    }
+    if err != nil {
+        _ = os.Remove(tmp)
+        return zerrors.WithMessagef(err, "写入快照失败<%s>", path)
+    }
+    return nil
+}
+
+// 从文件恢复数据, 文件不存在时不做任何事
+func (m *goCache) RestoreFile(path string) error {
+    f, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+    defer f.Close()
+    return zerrors.WithMessagef(m.Restore(f), "恢复快照失败<%s>", path)
+}
+
+// 解码从快照恢复的数据, 缓存中仍然是这个快照数据时替换为解码后的数据
+func (m *goCache) decodeValue(c *cache.Cache, path string, v *encodedValue, a interface{}) (interface{}, error) {
+    t := reflect.TypeOf(a)
+    if t == nil || t.Kind() != reflect.Ptr {
+        return nil, zerrors.NewSimplef("解码快照数据需要指针, 但收到了 %T", a)
+    }
+    out := reflect.New(t.Elem()).Interface()
+    if err := m.snapshot_codec.Decode(v.data, out); err != nil {
+        return nil, zerrors.WrapSimplef(err, "解码失败 %T", a)
+    }
+    // 接收数据的类型不确定时不替换缓存中的数据
+    if t.Elem().Kind() == reflect.Interface {
+        return out, nil
+    }
+
+    // 检查和替换之间不能有其它写入, 否则会覆盖新写入的数据
+    m.writeMx.Lock()
+    defer m.writeMx.Unlock()
+    if cur, expiration, ok := c.GetWithExpiration(path); ok && cur == v {
+        if expiration.IsZero() {
+            c.Set(path, out, 0)
+        } else if ex := time.Until(expiration); ex > 0 {
+            c.Set(path, out, ex)
+        }
+    }
+    return out, nil
+}
+
+// 后台定时写入快照
+func (m *goCache) snapshotLoop() {
+    defer m.loops.Done()
+    ticker := time.NewTicker(m.snapshot_interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-m.done:
+            return
+        case <-ticker.C:
+        }
+        if err := m.SnapshotFile(m.snapshot_path); err != nil {
+            m.snapshotError(err)
+        }
+    }
+}
+
+func (m *goCache) snapshotError(err error) {
+    if m.on_snapshot_error != nil {
+        m.on_snapshot_error(err)
+    }
+}
+
+func writeUvarint(w *bufio.Writer, n uint64) {
+    var buf [binary.MaxVarintLen64]byte
+    _, _ = w.Write(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+func writeBytes(w *bufio.Writer, bs []byte) {
+    writeUvarint(w, uint64(len(bs)))
+    _, _ = w.Write(bs)
+}
+
+// 快照读取器, 记录剩余的长度, 用于在分配内存前检查字段的长度
+type snapshotReader struct {
+    r      *bufio.Reader
+    remain int64 // 剩余长度, -1 表示未知
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+    n, err := r.r.Read(p)
+    if r.remain >= 0 {
+        r.remain -= int64(n)
+    }
+    return n, err
+}
+
+func (r *snapshotReader) ReadByte() (byte, error) {
+    b, err := r.r.ReadByte()
+    if err == nil && r.remain > 0 {
+        r.remain--
+    }
+    return b, err
+}
+
+// 获取r剩余的长度, 无法获取时返回 -1
+func readerSize(r io.Reader) int64 {
+    switch r := r.(type) {
+    case interface{ Len() int }:
+        return int64(r.Len())
+    case *os.File:
+        info, err := r.Stat()
+        if err != nil || !info.Mode().IsRegular() {
+            return -1
+        }
+        offset, err := r.Seek(0, io.SeekCurrent)
+        if err != nil {
+            return -1
+        }
+        return info.Size() - offset
+    }
+    return -1
+}
+
+// 读取字段, 长度超过最大长度或者剩余长度时返回错误, 避免损坏的快照导致分配大量内存
+func readBytes(r *snapshotReader) ([]byte, error) {
+    n, err := binary.ReadUvarint(r)
+    if err != nil {
+        return nil, err
+    }
+    if n > maxSnapshotFieldSize || (r.remain >= 0 && n > uint64(r.remain)) {
+        return nil, zerrors.NewSimplef("字段长度非预期: %d", n)
+    }
+    bs := make([]byte, n)
+    if _, err = io.ReadFull(r, bs); err != nil {
+        return nil, noEOF(err)
+    }
+    return bs, nil
+}
+
+// 记录中间出现的EOF表示快照不完整
+func noEOF(err error) error {
+    if err == io.EOF {
+        return io.ErrUnexpectedEOF
+    }
+    return err
+}
@@ -0,0 +1,113 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  标签索引
+-------------------------------------------------
+*/
+
+package go_cache
+
+import (
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/query"
+)
+
+var _ cachedb.ITagCacheDB = (*goCache)(nil)
+
+// 标签索引的最小清理阈值
+const minTagPruneSize = 64
+
+// 标签关联的数据
+type tagEntry struct {
+    space  string
+    path   string
+    expire time.Time // 零值表示永不过期
+}
+
+// 标签索引
+type tagIndex struct {
+    entries map[string]tagEntry // key为数据的完整路径
+    prune   int                 // 条目数量达到这个值时清理过期的条目
+}
+
+func (m *goCache) AddTags(query *query.Query, tags []string, ex time.Duration) error {
+    e := tagEntry{space: query.Space(), path: query.Path()}
+    if ex > 0 {
+        e.expire = time.Now().Add(ex)
+    }
+
+    m.tagMx.Lock()
+    for _, tag := range tags {
+        index, ok := m.tags[tag]
+        if !ok {
+            index = &tagIndex{entries: make(map[string]tagEntry), prune: minTagPruneSize}
+            m.tags[tag] = index
+        }
+        if old, ok := index.entries[query.FullPath()]; ok && (old.expire.IsZero() || (!e.expire.IsZero() && old.expire.After(e.expire))) {
+            continue
+        }
+
+        index.entries[query.FullPath()] = e
+        if len(index.entries) >= index.prune {
+            index.pruneExpired()
+        }
+    }
+    m.tagMx.Unlock()
+    return nil
+}
+
+func (m *goCache) DelTag(tag string) error {
+    m.tagMx.Lock()
+    index, ok := m.tags[tag]
+    delete(m.tags, tag)
+    m.tagMx.Unlock()
+
+    if !ok {
+        return nil
+    }
+
+    for _, e := range index.entries {
+        m.mx.RLock()
+        c, ok := m.cdbs[e.space]
+        m.mx.RUnlock()
+        if ok {
+            m.writeMx.RLock()
+            c.Delete(e.path)
+            m.writeMx.RUnlock()
+        }
+    }
+    return nil
+}
+
+// 从标签索引中移除空间的所有条目
+func (m *goCache) delSpaceTags(space string) {
+    m.tagMx.Lock()
+    for tag, index := range m.tags {
+        for k, e := range index.entries {
+            if e.space == space {
+                delete(index.entries, k)
+            }
+        }
+        if len(index.entries) == 0 {
+            delete(m.tags, tag)
+        }
+    }
+    m.tagMx.Unlock()
+}
+
+// 清理过期的条目, 下次清理的阈值为剩余条目数量的两倍
+func (index *tagIndex) pruneExpired() {
+    now := time.Now()
+    for k, e := range index.entries {
+        if !e.expire.IsZero() && now.After(e.expire) {
+            delete(index.entries, k)
+        }
+    }
+    index.prune = len(index.entries) * 2
+    if index.prune < minTagPruneSize {
+        index.prune = minTagPruneSize
+    }
+}
@@ -0,0 +1,305 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  限制内存的LRU缓存
+-------------------------------------------------
+*/
+
+package lru
+
+import (
+    "container/list"
+    "sync"
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/errs"
+    "github.com/zlyuancn/zbec/query"
+)
+
+const (
+    // 默认最大条目数量
+    DefaultMaxEntries = 10000
+    // 每个条目的固定开销, 用于估算占用的内存
+    entryOverhead = 64
+)
+
+var _ cachedb.ITTLCacheDB = (*Cache)(nil)
+var _ cachedb.ITagCacheDB = (*Cache)(nil)
+var _ cachedb.IPeekCacheDB = (*Cache)(nil)
+var _ cachedb.IClearCacheDB = (*Cache)(nil)
+
+// 空间占用
+type SpaceUsage struct {
+    // 条目数量
+    Entries int
+    // 估算的字节数
+    Bytes int64
+}
+
+type entry struct {
+    space  string
+    path   string
+    value  interface{}
+    size   int64
+    expire time.Time // 零值表示永不过期
+    tags   []string
+}
+
+type space struct {
+    entries map[string]*list.Element
+    bytes   int64
+}
+
+// LRU缓存, 条目数量或估算的字节数超过限制时淘汰最久没有使用的条目
+type Cache struct {
+    max_entries int
+    max_bytes   int64
+    sizer       func(v interface{}) int64
+
+    ll     *list.List
+    spaces map[string]*space
+    tags   map[string]map[*list.Element]struct{}
+    bytes  int64
+    mx     sync.Mutex
+}
+
+func New(opts ...Option) *Cache {
+    m := &Cache{
+        max_entries: DefaultMaxEntries,
+        sizer:       Sizeof,
+        ll:          list.New(),
+        spaces:      make(map[string]*space),
+        tags:        make(map[string]map[*list.Element]struct{}),
+    }
+    for _, o := range opts {
+        o(m)
+    }
+    return m
+}
+
+func (m *Cache) Set(query *query.Query, v interface{}, ex time.Duration) error {
+    e := &entry{
+        space: query.Space(),
+        path:  query.Path(),
+        value: v,
+        size:  int64(len(query.Space())+len(query.Path())+entryOverhead) + m.sizer(v),
+    }
+    if ex > 0 {
+        e.expire = time.Now().Add(ex)
+    }
+
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    if s, ok := m.spaces[e.space]; ok {
+        if el, ok := s.entries[e.path]; ok {
+            m.remove(el)
+        }
+    }
+
+    // 删除旧条目时可能删除了空间, 所以在删除之后获取
+    s, ok := m.spaces[e.space]
+    if !ok {
+        s = &space{entries: make(map[string]*list.Element)}
+        m.spaces[e.space] = s
+    }
+
+    s.entries[e.path] = m.ll.PushFront(e)
+    s.bytes += e.size
+    m.bytes += e.size
+    m.evict()
+    return nil
+}
+
+func (m *Cache) Get(query *query.Query, a interface{}) (interface{}, error) {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    el, ok := m.get(query)
+    if !ok {
+        return nil, errs.ErrNoEntry
+    }
+
+    m.ll.MoveToFront(el)
+    out := el.Value.(*entry).value
+    if out == errs.NoEntry {
+        return nil, errs.NoEntry
+    }
+    return out, nil
+}
+
+func (m *Cache) Peek(query *query.Query, a interface{}) (interface{}, error) {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    el, ok := m.get(query)
+    if !ok {
+        return nil, errs.ErrNoEntry
+    }
+
+    out := el.Value.(*entry).value
+    if out == errs.NoEntry {
+        return nil, errs.NoEntry
+    }
+    return out, nil
+}
+
+func (m *Cache) TTL(query *query.Query) (time.Duration, error) {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    el, ok := m.get(query)
+    if !ok {
+        return 0, errs.ErrNoEntry
+    }
+
+    e := el.Value.(*entry)
+    if e.expire.IsZero() {
+        return -1, nil
+    }
+    return time.Until(e.expire), nil
+}
+
+func (m *Cache) Del(query *query.Query) error {
+    m.mx.Lock()
+    if s, ok := m.spaces[query.Space()]; ok {
+        if el, ok := s.entries[query.Path()]; ok {
+            m.remove(el)
+        }
+    }
+    m.mx.Unlock()
+    return nil
+}
+
+func (m *Cache) DelSpaceData(space string) error {
+    m.mx.Lock()
+    if s, ok := m.spaces[space]; ok {
+        for _, el := range s.entries {
+            m.remove(el)
+        }
+    }
+    m.mx.Unlock()
+    return nil
+}
+
+func (m *Cache) Clear() error {
+    m.mx.Lock()
+    m.ll.Init()
+    m.spaces = make(map[string]*space)
+    m.tags = make(map[string]map[*list.Element]struct{})
+    m.bytes = 0
+    m.mx.Unlock()
+    return nil
+}
+
+func (m *Cache) AddTags(query *query.Query, tags []string, _ time.Duration) error {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    el, ok := m.get(query)
+    if !ok {
+        return nil
+    }
+
+    e := el.Value.(*entry)
+    for _, tag := range tags {
+        els, ok := m.tags[tag]
+        if !ok {
+            els = make(map[*list.Element]struct{})
+            m.tags[tag] = els
+        }
+        if _, ok = els[el]; !ok {
+            els[el] = struct{}{}
+            e.tags = append(e.tags, tag)
+        }
+    }
+    return nil
+}
+
+func (m *Cache) DelTag(tag string) error {
+    m.mx.Lock()
+    for el := range m.tags[tag] {
+        m.remove(el)
+    }
+    delete(m.tags, tag)
+    m.mx.Unlock()
+    return nil
+}
+
+// 获取每个空间的占用
+func (m *Cache) Usage() map[string]SpaceUsage {
+    m.mx.Lock()
+    out := make(map[string]SpaceUsage, len(m.spaces))
+    for name, s := range m.spaces {
+        out[name] = SpaceUsage{Entries: len(s.entries), Bytes: s.bytes}
+    }
+    m.mx.Unlock()
+    return out
+}
+
+// 获取条目总数量
+func (m *Cache) Len() int {
+    m.mx.Lock()
+    n := m.ll.Len()
+    m.mx.Unlock()
+    return n
+}
+
+// 获取估算的总字节数
+func (m *Cache) Bytes() int64 {
+    m.mx.Lock()
+    n := m.bytes
+    m.mx.Unlock()
+    return n
+}
+
+// 获取未过期的条目, 过期的条目会被删除
+func (m *Cache) get(query *query.Query) (*list.Element, bool) {
+    s, ok := m.spaces[query.Space()]
+    if !ok {
+        return nil, false
+    }
+    el, ok := s.entries[query.Path()]
+    if !ok {
+        return nil, false
+    }
+
+    e := el.Value.(*entry)
+    if !e.expire.IsZero() && time.Now().After(e.expire) {
+        m.remove(el)
+        return nil, false
+    }
+    return el, true
+}
+
+// 淘汰最久没有使用的条目直到满足限制, 最新写入的条目总是会保留
+func (m *Cache) evict() {
+    for m.ll.Len() > 1 && ((m.max_entries > 0 && m.ll.Len() > m.max_entries) || (m.max_bytes > 0 && m.bytes > m.max_bytes)) {
+        m.remove(m.ll.Back())
+    }
+}
+
+func (m *Cache) remove(el *list.Element) {
+    e := el.Value.(*entry)
+    m.ll.Remove(el)
+    m.bytes -= e.size
+
+    if s, ok := m.spaces[e.space]; ok {
+        delete(s.entries, e.path)
+        s.bytes -= e.size
+        if len(s.entries) == 0 {
+            delete(m.spaces, e.space)
+        }
+    }
+
+    for _, tag := range e.tags {
+        if els, ok := m.tags[tag]; ok {
+            delete(els, el)
+            if len(els) == 0 {
+                delete(m.tags, tag)
+            }
+        }
+    }
+}
@@ -0,0 +1,38 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package lru
+
+type Option func(m *Cache)
+
+// 设置最大条目数量, 默认为 10000, 为0表示不限制
+func WithMaxEntries(n int) Option {
+    return func(m *Cache) {
+        if n >= 0 {
+            m.max_entries = n
+        }
+    }
+}
+
+// 设置估算的最大字节数, 默认为0表示不限制
+func WithMaxBytes(n int64) Option {
+    return func(m *Cache) {
+        if n >= 0 {
+            m.max_bytes = n
+        }
+    }
+}
+
+// 设置估算数据占用字节数的函数, 默认为 Sizeof
+func WithSizer(sizer func(v interface{}) int64) Option {
+    return func(m *Cache) {
+        if sizer != nil {
+            m.sizer = sizer
+        }
+    }
+}
@@ -0,0 +1,89 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  估算数据占用的内存
+-------------------------------------------------
+*/
+
+package lru
+
+import (
+    "reflect"
+)
+
+// 最大递归深度, 超过后不再计算
+const maxSizeofDepth = 8
+
+// 估算数据占用的字节数, 会跟随指针丶切片丶map和结构体的字段, 结果只是近似值
+func Sizeof(v interface{}) int64 {
+    if v == nil {
+        return 0
+    }
+    return sizeof(reflect.ValueOf(v), 0)
+}
+
+func sizeof(v reflect.Value, depth int) int64 {
+    if !v.IsValid() {
+        return 0
+    }
+
+    size := int64(v.Type().Size())
+    if depth >= maxSizeofDepth {
+        return size
+    }
+
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        if !v.IsNil() {
+            size += sizeof(v.Elem(), depth+1)
+        }
+    case reflect.String:
+        size += int64(v.Len())
+    case reflect.Slice:
+        if v.IsNil() {
+            break
+        }
+        elem := v.Type().Elem()
+        if isFlat(elem.Kind()) {
+            size += int64(v.Len()) * int64(elem.Size())
+            break
+        }
+        for i := 0; i < v.Len(); i++ {
+            size += sizeof(v.Index(i), depth+1)
+        }
+    case reflect.Array:
+        if isFlat(v.Type().Elem().Kind()) {
+            break
+        }
+        size = 0
+        for i := 0; i < v.Len(); i++ {
+            size += sizeof(v.Index(i), depth+1)
+        }
+    case reflect.Map:
+        if v.IsNil() {
+            break
+        }
+        iter := v.MapRange()
+        for iter.Next() {
+            size += sizeof(iter.Key(), depth+1) + sizeof(iter.Value(), depth+1)
+        }
+    case reflect.Struct:
+        // 字段本身的大小已经计入, 只需要加上字段引用的数据
+        for i := 0; i < v.NumField(); i++ {
+            size += sizeof(v.Field(i), depth+1) - int64(v.Field(i).Type().Size())
+        }
+    }
+    return size
+}
+
+// 不引用其它数据的类型
+func isFlat(kind reflect.Kind) bool {
+    switch kind {
+    case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+        reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+        return true
+    }
+    return false
+}
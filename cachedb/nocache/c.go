@@ -16,7 +16,7 @@ import (
     "github.com/zlyuancn/zbec/query"
 )
 
-var _ cachedb.ICacheDB = (*noCache)(nil)
+var _ cachedb.IClearCacheDB = (*noCache)(nil)
 
 type noCache struct{}
 
@@ -29,3 +29,5 @@ func (noCache) Get(*query.Query, interface{}) (interface{}, error) { return nil,
 func (noCache) Del(*query.Query) error { return nil }
 
 func (noCache) DelSpaceData(string) error { return nil }
+
+func (noCache) Clear() error { return nil }
@@ -0,0 +1,183 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  基于redis位图的布隆过滤器
+-------------------------------------------------
+*/
+
+package redis
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/bloom"
+)
+
+const (
+    // 布隆过滤器的key前缀
+    BloomKeyPrefix = "zbec:bloom:"
+    // 默认重建的最长时间, 超过后其它进程可以重新开始重建
+    DefaultBloomRebuildTimeout = time.Minute * 10
+)
+
+var _ bloom.IFilter = (*BloomFilter)(nil)
+
+// KEYS: 过滤器, 重建标记, 重建中的过滤器; ARGV: 位置
+var bloomAddScript = rredis.NewScript(`
+local rebuilding = redis.call("exists", KEYS[2])
+for i = 1, #ARGV do
+    redis.call("setbit", KEYS[1], ARGV[i], 1)
+    if rebuilding == 1 then
+        redis.call("setbit", KEYS[3], ARGV[i], 1)
+    end
+end
+return 1
+`)
+
+// KEYS: 过滤器; ARGV: 位置. 过滤器不存在时返回1
+var bloomTestScript = rredis.NewScript(`
+if redis.call("exists", KEYS[1]) == 0 then
+    return 1
+end
+for i = 1, #ARGV do
+    if redis.call("getbit", KEYS[1], ARGV[i]) == 0 then
+        return 0
+    end
+end
+return 1
+`)
+
+// KEYS: 过滤器, 重建标记, 重建中的过滤器; ARGV: 令牌
+var bloomSwapScript = rredis.NewScript(`
+if redis.call("get", KEYS[2]) ~= ARGV[1] then
+    return 0
+end
+if redis.call("exists", KEYS[3]) == 1 then
+    redis.call("rename", KEYS[3], KEYS[1])
+else
+    redis.call("del", KEYS[1])
+end
+redis.call("del", KEYS[2])
+return 1
+`)
+
+// 基于redis位图的布隆过滤器, 多个进程可以共享同一个过滤器
+//
+// 相关的key使用了相同的hash tag, 在集群模式下会分配到同一个slot
+type BloomFilter struct {
+    cdb             rredis.UniversalClient
+    key             string
+    rebuilding_key  string
+    pending_key     string
+    m               uint64
+    k               uint
+    rebuild_timeout time.Duration
+}
+
+// 创建一个基于redis位图的布隆过滤器, name 为过滤器名, n 为预计的key数量, fp 为误判率
+func NewBloomFilter(db rredis.UniversalClient, name string, n uint64, fp float64) *BloomFilter {
+    m, k := bloom.Estimate(n, fp)
+    key := BloomKeyPrefix + "{" + name + "}"
+    return &BloomFilter{
+        cdb:             db,
+        key:             key,
+        rebuilding_key:  key + ":rebuilding",
+        pending_key:     key + ":pending",
+        m:               m,
+        k:               k,
+        rebuild_timeout: DefaultBloomRebuildTimeout,
+    }
+}
+
+// 设置重建的最长时间
+func (f *BloomFilter) SetRebuildTimeout(timeout time.Duration) *BloomFilter {
+    if timeout > 0 {
+        f.rebuild_timeout = timeout
+    }
+    return f
+}
+
+func (f *BloomFilter) Add(ctx context.Context, keys ...string) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    return f.add([]string{f.key, f.rebuilding_key, f.pending_key}, keys)
+}
+
+func (f *BloomFilter) Test(ctx context.Context, key string) (bool, error) {
+    if err := ctx.Err(); err != nil {
+        return false, err
+    }
+    ok, err := bloomTestScript.Run(f.cdb, []string{f.key}, f.locations(key)...).Int()
+    if err != nil {
+        return false, zerrors.WithSimple(err)
+    }
+    return ok == 1, nil
+}
+
+// 重建过滤器, 同一时刻只有一个进程可以重建
+func (f *BloomFilter) Rebuild(ctx context.Context, fill func(add func(keys ...string) error) error) error {
+    token, err := makeToken()
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+
+    ok, err := f.cdb.SetNX(f.rebuilding_key, token, f.rebuild_timeout).Result()
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+    if !ok {
+        return zerrors.NewSimple("其它进程正在重建布隆过滤器")
+    }
+
+    err = f.cdb.Del(f.pending_key).Err()
+    if err == nil {
+        err = fill(func(keys ...string) error {
+            if err := ctx.Err(); err != nil {
+                return err
+            }
+            return f.add([]string{f.pending_key, f.rebuilding_key, f.pending_key}, keys)
+        })
+    }
+    if err != nil {
+        _ = unlockScript.Run(f.cdb, []string{f.rebuilding_key}, token).Err()
+        _ = f.cdb.Del(f.pending_key).Err()
+        return err
+    }
+
+    swapped, err := bloomSwapScript.Run(f.cdb, []string{f.key, f.rebuilding_key, f.pending_key}, token).Int()
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+    if swapped == 0 {
+        return zerrors.NewSimple("重建布隆过滤器超时")
+    }
+    return nil
+}
+
+func (f *BloomFilter) add(scriptKeys []string, keys []string) error {
+    if len(keys) == 0 {
+        return nil
+    }
+
+    args := make([]interface{}, 0, len(keys)*int(f.k))
+    for _, key := range keys {
+        args = append(args, f.locations(key)...)
+    }
+    return zerrors.WithSimple(bloomAddScript.Run(f.cdb, scriptKeys, args...).Err())
+}
+
+func (f *BloomFilter) locations(key string) []interface{} {
+    locs := bloom.Locations(key, f.k, f.m)
+    out := make([]interface{}, len(locs))
+    for i, loc := range locs {
+        out[i] = strconv.FormatUint(loc, 10)
+    }
+    return out
+}
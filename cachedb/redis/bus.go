@@ -0,0 +1,169 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  基于redis发布订阅的本地缓存失效总线
+-------------------------------------------------
+*/
+
+package redis
+
+import (
+    "context"
+    "encoding/json"
+    "sync"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+const (
+    // 默认失效事件频道
+    DefaultInvalidationChannel = "zbec:invalidation"
+    // 默认连接断开后的重试间隔
+    DefaultReconnectInterval = time.Second
+)
+
+var _ cachedb.IInvalidationBus = (*InvalidationBus)(nil)
+
+// 本地缓存失效总线, 通过redis的发布订阅在多个进程之间同步删除本地缓存
+//
+// 连接断开期间发布的事件会丢失, 所以重新连接后会通知订阅者清除所有本地缓存
+//
+//  bec := zbec.New(cdb, zbec.WithLocalCache(true), zbec.WithInvalidationBus(redis.NewInvalidationBus(client)))
+type InvalidationBus struct {
+    cdb                rredis.UniversalClient
+    channel            string
+    id                 string
+    ignore_self        bool
+    reconnect_interval time.Duration
+    on_error           func(err error)
+
+    pubsub *rredis.PubSub
+    done   chan struct{}
+    mx     sync.Mutex
+}
+
+func NewInvalidationBus(db rredis.UniversalClient, opts ...BusOption) *InvalidationBus {
+    id, _ := makeToken()
+    m := &InvalidationBus{
+        cdb:                db,
+        channel:            DefaultInvalidationChannel,
+        id:                 id,
+        reconnect_interval: DefaultReconnectInterval,
+        done:               make(chan struct{}),
+    }
+    for _, o := range opts {
+        o(m)
+    }
+    return m
+}
+
+// 发布者id, 每个总线实例都不同
+func (m *InvalidationBus) ID() string {
+    return m.id
+}
+
+func (m *InvalidationBus) Publish(ctx context.Context, event *cachedb.InvalidationEvent) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    e := *event
+    e.Source = m.id
+    bs, err := json.Marshal(&e)
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+    return zerrors.WithSimple(m.cdb.Publish(m.channel, bs).Err())
+}
+
+func (m *InvalidationBus) Subscribe(handler func(event *cachedb.InvalidationEvent)) error {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    if m.pubsub != nil {
+        return zerrors.NewSimple("已经订阅过了")
+    }
+    select {
+    case <-m.done:
+        return zerrors.NewSimple("总线已关闭")
+    default:
+    }
+
+    m.pubsub = m.cdb.Subscribe(m.channel)
+    go m.receive(m.pubsub, handler)
+    return nil
+}
+
+// 停止订阅
+func (m *InvalidationBus) Close() error {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    select {
+    case <-m.done:
+        return nil
+    default:
+    }
+    close(m.done)
+    if m.pubsub != nil {
+        return m.pubsub.Close()
+    }
+    return nil
+}
+
+// 接收事件, 连接断开时 PubSub 会在下次接收时重新连接并重新订阅
+func (m *InvalidationBus) receive(pubsub *rredis.PubSub, handler func(event *cachedb.InvalidationEvent)) {
+    subscribed, lost := false, false
+    for {
+        msg, err := pubsub.Receive()
+        if err != nil {
+            select {
+            case <-m.done:
+                return
+            default:
+            }
+
+            m.error(zerrors.WithMessage(err, "接收失效事件失败"))
+            lost = true
+            select {
+            case <-m.done:
+                return
+            case <-time.After(m.reconnect_interval):
+            }
+            continue
+        }
+
+        switch msg := msg.(type) {
+        case *rredis.Subscription:
+            if msg.Kind != "subscribe" {
+                continue
+            }
+            // 重新订阅成功, 断开期间的事件已经丢失
+            if subscribed && lost {
+                handler(&cachedb.InvalidationEvent{Op: cachedb.InvalidateAll})
+            }
+            subscribed, lost = true, false
+        case *rredis.Message:
+            var event cachedb.InvalidationEvent
+            if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+                m.error(zerrors.WithMessage(err, "解码失效事件失败"))
+                continue
+            }
+            if m.ignore_self && event.Source == m.id {
+                continue
+            }
+            handler(&event)
+        }
+    }
+}
+
+func (m *InvalidationBus) error(err error) {
+    if m.on_error != nil {
+        m.on_error(err)
+    }
+}
@@ -10,8 +10,11 @@ package redis
 
 import (
     "bytes"
+    "context"
     "crypto/md5"
     "encoding/hex"
+    "io"
+    "sync"
     "time"
 
     "github.com/afex/hystrix-go/hystrix"
@@ -22,22 +25,43 @@ import (
     "github.com/zlyuancn/zbec/codec"
     "github.com/zlyuancn/zbec/errs"
     "github.com/zlyuancn/zbec/query"
+    "github.com/zlyuancn/zbec/retry"
 )
 
-var _ cachedb.ICacheDB = (*redisWrap)(nil)
+var _ cachedb.IBatchCacheDB = (*redisWrap)(nil)
+var _ cachedb.ITTLCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextBatchCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextTTLCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextSpaceCacheDB = (*redisWrap)(nil)
+var _ cachedb.ICodecCacheDB = (*redisWrap)(nil)
+var _ io.Closer = (*redisWrap)(nil)
+var _ cachedb.IKeyCacheDB = (*redisWrap)(nil)
 
 type redisWrap struct {
     cdb        rredis.UniversalClient
     codec      codec.ICodec
+    codec_type codec.CodecType
     md5_params bool
     qfname     string // qf是断路器符号
+    observer   cachedb.Observer
+    retry      *retry.Policy
+
+    del_space_mode DelSpaceMode  // 删除空间数据的方式
+    scan_count     int64         // 扫描时每批的数量
+    gen_refresh    time.Duration // 空间代数在本地的缓存时间
+    gens           sync.Map      // 空间代数的本地缓存
 }
 
 func Wrap(db rredis.UniversalClient, opts ...Option) cachedb.ICacheDB {
     m := &redisWrap{
         cdb:        db,
         codec:      codec.GetCodec(codec.DefaultCodecType),
+        codec_type: codec.DefaultCodecType,
         md5_params: true,
+
+        scan_count:  DefaultScanCount,
+        gen_refresh: DefaultGenerationRefresh,
     }
     for _, o := range opts {
         o(m)
@@ -46,9 +70,18 @@ func Wrap(db rredis.UniversalClient, opts ...Option) cachedb.ICacheDB {
 }
 
 func (m *redisWrap) Set(query *query.Query, v interface{}, ex time.Duration) error {
+    return m.SetContext(context.Background(), query, v, ex)
+}
+
+func (m *redisWrap) SetContext(ctx context.Context, query *query.Query, v interface{}, ex time.Duration) error {
+    key, err := m.key(ctx, query)
+    if err != nil {
+        return err
+    }
+
     if v == errs.NoEntry {
-        return m.do(func() error {
-            return m.cdb.Set(m.makeKey(query), []byte{}, ex).Err()
+        return m.do(ctx, "set", func(c rredis.UniversalClient) error {
+            return c.Set(key, []byte{}, ex).Err()
         })
     }
 
@@ -56,17 +89,25 @@ func (m *redisWrap) Set(query *query.Query, v interface{}, ex time.Duration) err
     if err != nil {
         return zerrors.WrapSimplef(err, "编码失败 %T", v)
     }
-    return m.do(func() error {
-        return m.cdb.Set(m.makeKey(query), bs, ex).Err()
+    return m.do(ctx, "set", func(c rredis.UniversalClient) error {
+        return c.Set(key, bs, ex).Err()
     })
 }
 
 func (m *redisWrap) Get(query *query.Query, a interface{}) (interface{}, error) {
+    return m.GetContext(context.Background(), query, a)
+}
+
+func (m *redisWrap) GetContext(ctx context.Context, query *query.Query, a interface{}) (interface{}, error) {
+    key, err := m.key(ctx, query)
+    if err != nil {
+        return nil, err
+    }
+
     var data []byte
-    var err error
     empty := false
-    err = m.do(func() error {
-        bs, e := m.cdb.Get(m.makeKey(query)).Bytes()
+    err = m.do(ctx, "get", func(c rredis.UniversalClient) error {
+        bs, e := c.Get(key).Bytes()
         data = bs
         if e == rredis.Nil {
             empty = true
@@ -81,21 +122,106 @@ func (m *redisWrap) Get(query *query.Query, a interface{}) (interface{}, error)
     if empty {
         return nil, errs.ErrNoEntry
     }
-    if len(data) == 0 {
-        return nil, errs.NoEntry
+    return m.decode(data, a)
+}
+
+func (m *redisWrap) MGet(queries []*query.Query, as []interface{}) ([]interface{}, []error) {
+    return m.MGetContext(context.Background(), queries, as)
+}
+
+func (m *redisWrap) MGetContext(ctx context.Context, queries []*query.Query, as []interface{}) ([]interface{}, []error) {
+    outs := make([]interface{}, len(queries))
+    es := make([]error, len(queries))
+
+    keys := make([]string, len(queries))
+    for i, q := range queries {
+        key, err := m.key(ctx, q)
+        if err != nil {
+            for i := range es {
+                es[i] = err
+            }
+            return outs, es
+        }
+        keys[i] = key
     }
 
-    err = m.codec.Decode(data, a)
+    var cmds []*rredis.StringCmd
+    err := m.do(ctx, "mget", func(c rredis.UniversalClient) error {
+        pipe := c.Pipeline()
+        cmds = make([]*rredis.StringCmd, len(keys))
+        for i, key := range keys {
+            cmds[i] = pipe.Get(key)
+        }
+        _, e := pipe.Exec()
+        if e == rredis.Nil {
+            return nil
+        }
+        return e
+    })
+
     if err != nil {
-        return nil, zerrors.WrapSimplef(err, "解码失败 %T", a)
+        err = zerrors.WithSimple(err)
+        for i := range es {
+            es[i] = err
+        }
+        return outs, es
     }
 
-    return a, nil
+    for i, cmd := range cmds {
+        data, e := cmd.Bytes()
+        if e == rredis.Nil {
+            es[i] = errs.ErrNoEntry
+            continue
+        }
+        if e != nil {
+            es[i] = zerrors.WithSimple(e)
+            continue
+        }
+        outs[i], es[i] = m.decode(data, as[i])
+    }
+    return outs, es
+}
+
+func (m *redisWrap) TTL(query *query.Query) (time.Duration, error) {
+    return m.TTLContext(context.Background(), query)
+}
+
+func (m *redisWrap) TTLContext(ctx context.Context, query *query.Query) (time.Duration, error) {
+    key, err := m.key(ctx, query)
+    if err != nil {
+        return 0, err
+    }
+
+    var ttl time.Duration
+    err = m.do(ctx, "ttl", func(c rredis.UniversalClient) (e error) {
+        ttl, e = c.PTTL(key).Result()
+        return e
+    })
+    if err != nil {
+        return 0, zerrors.WithSimple(err)
+    }
+
+    switch {
+    case ttl == -2*time.Millisecond: // key不存在
+        return 0, errs.ErrNoEntry
+    case ttl < 0: // 永不过期
+        return -1, nil
+    }
+    return ttl, nil
 }
 
 func (m *redisWrap) Del(query *query.Query) error {
-    return m.do(func() error {
-        err := m.cdb.Del(m.makeKey(query)).Err()
+    return m.DelContext(context.Background(), query)
+}
+
+func (m *redisWrap) DelContext(ctx context.Context, query *query.Query) error {
+    key, err := m.key(ctx, query)
+    if err != nil {
+        return err
+    }
+
+    return m.do(ctx, "del", func(c rredis.UniversalClient) error {
+        err := c.Del(key).Err()
         if err == rredis.Nil {
             return nil
         }
@@ -104,14 +230,60 @@ func (m *redisWrap) Del(query *query.Query) error {
 }
 
 func (m *redisWrap) DelSpaceData(space string) error {
-    return zerrors.NewSimple("不提供删除空间数据功能")
+    return m.DelSpaceDataContext(context.Background(), space)
 }
 
-func (m *redisWrap) makeKey(query *query.Query) string {
+func (m *redisWrap) DelSpaceDataContext(ctx context.Context, space string) error {
+    if m.del_space_mode == DelSpaceByGeneration {
+        return m.incrGeneration(ctx, space)
+    }
+    return m.delSpaceByScan(ctx, space)
+}
+
+func (m *redisWrap) CodecType() codec.CodecType {
+    return m.codec_type
+}
+
+func (m *redisWrap) decode(data []byte, a interface{}) (interface{}, error) {
+    if len(data) == 0 {
+        return nil, errs.NoEntry
+    }
+
+    err := m.codec.Decode(data, a)
+    if err != nil {
+        return nil, zerrors.WrapSimplef(err, "解码失败 %T", a)
+    }
+    return a, nil
+}
+
+// 获取query在redis中的key, 按代数删除空间时key中会带上空间的代数
+func (m *redisWrap) key(ctx context.Context, query *query.Query) (string, error) {
+    if m.del_space_mode != DelSpaceByGeneration {
+        return m.makeKey(query, ""), nil
+    }
+
+    gen, err := m.generation(ctx, query.Space())
+    if err != nil {
+        return "", err
+    }
+    return m.makeKey(query, gen), nil
+}
+
+func (m *redisWrap) makeKey(query *query.Query, gen string) string {
+    return MakeKey(query, gen, m.md5_params)
+}
+
+// 计算query在redis中的key, 格式为 空间名:[代数:]路径
+// gen 为空间的代数, 不按代数删除空间时为空, md5Params 与 WithMd5QueryParams 的设置相同
+func MakeKey(query *query.Query, gen string, md5Params bool) string {
     var bs bytes.Buffer
     bs.WriteString(query.Space())
     bs.WriteByte(':')
-    if m.md5_params {
+    if gen != "" {
+        bs.WriteString(gen)
+        bs.WriteByte(':')
+    }
+    if md5Params {
         bs.Write(makeMd5(query.Path()))
     } else {
         bs.WriteString(query.Path())
@@ -128,9 +300,62 @@ func makeMd5(text string) []byte {
     return dst
 }
 
-func (m *redisWrap) do(fn func() error) error {
+func (m *redisWrap) do(ctx context.Context, op string, fn func(c rredis.UniversalClient) error) (err error) {
+    if err = ctx.Err(); err != nil {
+        return err
+    }
+
+    if m.observer != nil {
+        start := time.Now()
+        defer func() {
+            m.observer(op, time.Since(start), err)
+        }()
+    }
+
+    c := m.client(ctx)
+    if m.retry == nil {
+        return m.call(ctx, c, fn)
+    }
+    return m.retry.Do(ctx, func(ctx context.Context) error {
+        err := m.call(ctx, c, fn)
+        // 断路器拒绝的请求不需要重试
+        if err == hystrix.ErrCircuitOpen || err == hystrix.ErrMaxConcurrency {
+            return retry.Stop(err)
+        }
+        return err
+    })
+}
+
+func (m *redisWrap) call(ctx context.Context, c rredis.UniversalClient, fn func(c rredis.UniversalClient) error) error {
     if m.qfname == "" {
-        return fn()
+        return fn(c)
+    }
+    return hystrix.DoC(ctx, m.qfname, func(context.Context) error {
+        return fn(c)
+    }, nil)
+}
+
+// 获取绑定了上下文的客户端, 上下文中的值可以被客户端的钩子读取
+func (m *redisWrap) client(ctx context.Context) rredis.UniversalClient {
+    if ctx == context.Background() {
+        return m.cdb
     }
-    return hystrix.Do(m.qfname, fn, nil)
+
+    switch c := m.cdb.(type) {
+    case *rredis.Client:
+        return c.WithContext(ctx)
+    case *rredis.ClusterClient:
+        return c.WithContext(ctx)
+    }
+    return m.cdb
+}
+
+// 关闭redis客户端
+func (m *redisWrap) Close() error {
+    return m.cdb.Close()
+}
+
+// 获取query在redis中的key, 按代数删除空间时会从redis获取空间的代数
+func (m *redisWrap) CacheKey(query *query.Query) (string, error) {
+    return m.key(context.Background(), query)
 }
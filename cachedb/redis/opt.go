@@ -9,7 +9,11 @@
 package redis
 
 import (
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
     "github.com/zlyuancn/zbec/codec"
+    "github.com/zlyuancn/zbec/retry"
 )
 
 type Option func(m *redisWrap)
@@ -18,6 +22,7 @@ type Option func(m *redisWrap)
 func WithCodecType(ctype codec.CodecType) Option {
     return func(m *redisWrap) {
         m.codec = codec.GetCodec(ctype)
+        m.codec_type = ctype
     }
 }
 
@@ -28,9 +33,127 @@ func WithHystrixName(qfname string) Option {
     }
 }
 
+// 设置重试策略, redis操作失败时会按策略重试, 断路器拒绝的请求不会重试
+// 所有操作都会重试, 按代数删除空间数据时重试可能会使代数多增加几次, 不会影响结果
+func WithRetry(policy *retry.Policy) Option {
+    return func(m *redisWrap) {
+        m.retry = policy
+    }
+}
+
 // 将query的params做md5, 默认为true
 func WithMd5QueryParams(b bool) Option {
     return func(m *redisWrap) {
         m.md5_params = b
     }
 }
+
+// 设置调用观察者, 每次调用redis后会将操作名丶耗时和错误告知观察者, 可以用于收集监控数据
+func WithObserver(observer cachedb.Observer) Option {
+    return func(m *redisWrap) {
+        m.observer = observer
+    }
+}
+
+// 设置删除空间数据的方式, 默认为 DelSpaceByScan
+func WithDelSpaceMode(mode DelSpaceMode) Option {
+    return func(m *redisWrap) {
+        m.del_space_mode = mode
+    }
+}
+
+// 设置删除空间数据时每批扫描的数量, 默认为 500
+func WithScanCount(count int64) Option {
+    return func(m *redisWrap) {
+        if count > 0 {
+            m.scan_count = count
+        }
+    }
+}
+
+// 设置空间代数在本地的缓存时间, 默认为 1秒, 为0时每次都从redis获取
+func WithGenerationRefresh(d time.Duration) Option {
+    return func(m *redisWrap) {
+        if d >= 0 {
+            m.gen_refresh = d
+        }
+    }
+}
+
+type SingleFlightOption func(m *SingleFlight)
+
+// 设置锁key前缀, 默认为 zbec:lock:
+func WithLockKeyPrefix(prefix string) SingleFlightOption {
+    return func(m *SingleFlight) {
+        m.prefix = prefix
+    }
+}
+
+// 设置锁有效时间, 应该大于加载器的最大耗时
+func WithLockExpire(ex time.Duration) SingleFlightOption {
+    return func(m *SingleFlight) {
+        if ex > 0 {
+            m.lock_ex = ex
+        }
+    }
+}
+
+// 设置等待其它进程加载的超时时间, 超时后会自己调用加载器
+func WithLockWaitTimeout(timeout time.Duration) SingleFlightOption {
+    return func(m *SingleFlight) {
+        if timeout > 0 {
+            m.wait_timeout = timeout
+        }
+    }
+}
+
+// 设置等待时检查缓存的间隔
+func WithLockPollInterval(interval time.Duration) SingleFlightOption {
+    return func(m *SingleFlight) {
+        if interval > 0 {
+            m.poll_interval = interval
+        }
+    }
+}
+
+// 设置redis出错时的处理函数, 默认通过 zlog2.DefaultLogger 输出警告
+// 获取锁失败时会不加锁直接调用加载器
+func WithLockErrorHandler(fn func(err error)) SingleFlightOption {
+    return func(m *SingleFlight) {
+        m.on_error = fn
+    }
+}
+
+type BusOption func(m *InvalidationBus)
+
+// 设置失效事件频道, 默认为 zbec:invalidation
+func WithChannel(channel string) BusOption {
+    return func(m *InvalidationBus) {
+        if channel != "" {
+            m.channel = channel
+        }
+    }
+}
+
+// 设置是否忽略自己发布的事件, 默认为false, 发布者自己的本地缓存已经删除过了, 可以忽略以减少重复删除
+func WithIgnoreSelf(b bool) BusOption {
+    return func(m *InvalidationBus) {
+        m.ignore_self = b
+    }
+}
+
+// 设置连接断开后的重试间隔, 默认为 1秒
+func WithReconnectInterval(interval time.Duration) BusOption {
+    return func(m *InvalidationBus) {
+        if interval > 0 {
+            m.reconnect_interval = interval
+        }
+    }
+}
+
+// 设置接收事件出错时的处理函数, 默认忽略错误
+func WithBusErrorHandler(fn func(err error)) BusOption {
+    return func(m *InvalidationBus) {
+        m.on_error = fn
+    }
+}
@@ -0,0 +1,158 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  基于redis分布式锁的跨进程单飞模块
+-------------------------------------------------
+*/
+
+package redis
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+    "github.com/zlyuancn/zerrors"
+    "github.com/zlyuancn/zlog2"
+    "github.com/zlyuancn/zsingleflight"
+)
+
+const (
+    // 默认锁key前缀
+    DefaultLockKeyPrefix = "zbec:lock:"
+    // 默认锁有效时间, 加载时间超过这个值时等待的进程会认为加载失败
+    DefaultLockExpire = time.Second * 10
+    // 默认等待其它进程加载的超时时间, 超时后会自己调用加载器
+    DefaultLockWaitTimeout = time.Second * 5
+    // 默认等待时检查缓存的间隔
+    DefaultLockPollInterval = time.Millisecond * 50
+)
+
+// 持有锁的进程释放锁后数据仍未写入缓存, 说明它加载失败了
+var ErrLockHolderFailed = errors.New("持有锁的进程加载失败")
+
+// 只有锁的值等于自己的令牌时才删除, 避免锁过期后删除了其它进程的锁
+var unlockScript = rredis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+    return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// 跨进程的单飞模块, 进程内通过 zsingleflight 合并请求, 调用加载器前通过 SET NX PX 获取分布式锁,
+// 没有获得锁的进程会轮询缓存直到数据写入或者锁被释放, 锁被释放时数据仍未写入会返回 ErrLockHolderFailed,
+// 调用者有保留的过期数据时会返回过期数据
+//
+//  bec := zbec.New(cdb, zbec.WithSingleFlight(redis.NewSingleFlight(client)))
+type SingleFlight struct {
+    cdb           rredis.UniversalClient
+    sf            *zsingleflight.SingleFlight
+    prefix        string
+    lock_ex       time.Duration
+    wait_timeout  time.Duration
+    poll_interval time.Duration
+    on_error      func(err error)
+}
+
+func NewSingleFlight(db rredis.UniversalClient, opts ...SingleFlightOption) *SingleFlight {
+    m := &SingleFlight{
+        cdb:           db,
+        sf:            zsingleflight.New(),
+        prefix:        DefaultLockKeyPrefix,
+        lock_ex:       DefaultLockExpire,
+        wait_timeout:  DefaultLockWaitTimeout,
+        poll_interval: DefaultLockPollInterval,
+        on_error: func(err error) {
+            zlog2.DefaultLogger.Warn(err)
+        },
+    }
+    for _, o := range opts {
+        o(m)
+    }
+    return m
+}
+
+// 进程内合并请求
+func (m *SingleFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+    return m.sf.Do(key, fn)
+}
+
+// 跨进程只有获得锁的调用者执行 load, 其它调用者轮询 recheck 直到数据写入缓存,
+// 锁被释放后数据仍未写入时说明持有锁的进程加载失败, 直接返回 ErrLockHolderFailed, 不会再次调用 load
+// 等待超时或redis不可用时直接执行 load
+func (m *SingleFlight) DoLoad(ctx context.Context, key string, load func() (interface{}, error), recheck func() (interface{}, bool, error)) (interface{}, error) {
+    lockKey := m.prefix + string(makeMd5(key))
+    token, err := makeToken()
+    if err != nil {
+        m.error(zerrors.WrapSimplef(err, "生成锁令牌失败, 不加锁直接加载<%s>", key))
+        return load()
+    }
+
+    ok, err := m.cdb.SetNX(lockKey, token, m.lock_ex).Result()
+    if err != nil {
+        m.error(zerrors.WrapSimplef(err, "获取锁失败, 不加锁直接加载<%s>", key))
+        return load()
+    }
+    if ok {
+        defer m.unlock(lockKey, token)
+        return load()
+    }
+
+    deadline := time.Now().Add(m.wait_timeout)
+    timer := time.NewTimer(m.poll_interval)
+    defer timer.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-timer.C:
+        }
+
+        if out, ok, err := recheck(); ok {
+            return out, err
+        }
+
+        n, err := m.cdb.Exists(lockKey).Result()
+        if err != nil {
+            m.error(zerrors.WrapSimplef(err, "检查锁失败, 不加锁直接加载<%s>", key))
+            return load()
+        }
+        if n == 0 {
+            // 持有锁的进程可能在上次检查后写入数据并释放了锁
+            if out, ok, err := recheck(); ok {
+                return out, err
+            }
+            return nil, ErrLockHolderFailed
+        }
+
+        if time.Now().After(deadline) {
+            return load()
+        }
+        timer.Reset(m.poll_interval)
+    }
+}
+
+// 释放锁, 即使调用者的上下文已经结束也要释放
+func (m *SingleFlight) unlock(lockKey, token string) {
+    if err := unlockScript.Run(m.cdb, []string{lockKey}, token).Err(); err != nil {
+        m.error(zerrors.WrapSimple(err, "释放锁失败"))
+    }
+}
+
+func (m *SingleFlight) error(err error) {
+    if m.on_error != nil {
+        m.on_error(err)
+    }
+}
+
+func makeToken() (string, error) {
+    bs := make([]byte, 16)
+    if _, err := rand.Read(bs); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(bs), nil
+}
@@ -0,0 +1,179 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  删除空间数据
+-------------------------------------------------
+*/
+
+package redis
+
+import (
+    "context"
+    "crypto/md5"
+    "strconv"
+    "strings"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+    "github.com/zlyuancn/zerrors"
+)
+
+// 删除空间数据的方式
+type DelSpaceMode int
+
+const (
+    // 通过 SCAN 找到空间的所有key后分批 UNLINK, 耗时和空间的数据量相关
+    DelSpaceByScan DelSpaceMode = iota
+    // key中会带上空间的代数, 删除空间数据时只需要增加代数, 旧数据在过期后由redis删除
+    //
+    // 其它进程最多在 WithGenerationRefresh 设置的时间后才能看到新的代数, 没有设置有效时间的旧数据不会被删除
+    DelSpaceByGeneration
+)
+
+const (
+    // 默认扫描时每批的数量
+    DefaultScanCount = 500
+    // 默认空间代数在本地的缓存时间
+    DefaultGenerationRefresh = time.Second
+    // 空间代数的key前缀
+    GenerationKeyPrefix = "zbec:gen:"
+)
+
+var matchReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// 匹配空间所有key的 SCAN 模式, 会匹配到以 space: 开头的其它空间和本模块的key, 需要通过 IsSpaceKey 过滤
+func SpaceKeyPattern(space string) string {
+    return matchReplacer.Replace(space) + ":*"
+}
+
+// 判断key是否是空间的数据key
+//
+// 数据key为 space:md5(path) 或 space:path, path为空或者以?开头, 所以 space:其它 开头的key属于其它空间或者本模块的锁和标签等
+func IsSpaceKey(space, key string) bool {
+    if len(key) <= len(space) || key[:len(space)] != space || key[len(space)] != ':' {
+        return false
+    }
+    rest := key[len(space)+1:]
+    return rest == "" || rest[0] == '?' || isMd5Hex(rest)
+}
+
+func isMd5Hex(s string) bool {
+    if len(s) != md5.Size*2 {
+        return false
+    }
+    for i := 0; i < len(s); i++ {
+        if c := s[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+// 扫描空间的所有key并删除
+func (m *redisWrap) delSpaceByScan(ctx context.Context, space string) error {
+    // 空间名包含?时无法区分 a:?b 的 ?b 是参数还是空间名的一部分
+    if strings.Contains(space, "?") {
+        return zerrors.NewSimplef("通过SCAN删除空间数据时空间名不能包含?: %s", space)
+    }
+
+    match := SpaceKeyPattern(space)
+    scan := func(c rredis.UniversalClient) error {
+        var cursor uint64
+        for {
+            keys, next, err := c.Scan(cursor, match, m.scan_count).Result()
+            if err != nil {
+                return err
+            }
+
+            // 过滤掉以 space: 开头的其它空间的key
+            n := 0
+            for _, key := range keys {
+                if IsSpaceKey(space, key) {
+                    keys[n] = key
+                    n++
+                }
+            }
+            keys = keys[:n]
+
+            // 集群模式下不同slot的key不能在一个命令中删除, 所以逐个删除
+            if len(keys) > 0 {
+                pipe := c.Pipeline()
+                for _, key := range keys {
+                    pipe.Unlink(key)
+                }
+                if _, err = pipe.Exec(); err != nil {
+                    return err
+                }
+            }
+
+            if next == 0 {
+                return nil
+            }
+            cursor = next
+        }
+    }
+
+    err := m.do(ctx, "del_space", func(c rredis.UniversalClient) error {
+        if cc, ok := c.(*rredis.ClusterClient); ok {
+            return cc.ForEachMaster(func(client *rredis.Client) error {
+                return scan(client)
+            })
+        }
+        return scan(c)
+    })
+    return zerrors.WithSimple(err)
+}
+
+// 空间代数的本地缓存
+type generation struct {
+    value  string
+    expire time.Time
+}
+
+// 获取空间的代数
+func (m *redisWrap) generation(ctx context.Context, space string) (string, error) {
+    if v, ok := m.gens.Load(space); ok {
+        g := v.(*generation)
+        if time.Now().Before(g.expire) {
+            return g.value, nil
+        }
+    }
+
+    var value string
+    err := m.do(ctx, "gen", func(c rredis.UniversalClient) (e error) {
+        value, e = c.Get(GenerationKeyPrefix + space).Result()
+        if e == rredis.Nil {
+            value = "0"
+            return nil
+        }
+        return e
+    })
+    if err != nil {
+        return "", zerrors.WithSimple(err)
+    }
+
+    m.storeGeneration(space, value)
+    return value, nil
+}
+
+// 增加空间的代数
+func (m *redisWrap) incrGeneration(ctx context.Context, space string) error {
+    var value int64
+    err := m.do(ctx, "del_space", func(c rredis.UniversalClient) (e error) {
+        value, e = c.Incr(GenerationKeyPrefix + space).Result()
+        return e
+    })
+    if err != nil {
+        return zerrors.WithSimple(err)
+    }
+
+    m.storeGeneration(space, strconv.FormatInt(value, 10))
+    return nil
+}
+
+func (m *redisWrap) storeGeneration(space, value string) {
+    if m.gen_refresh > 0 {
+        m.gens.Store(space, &generation{value: value, expire: time.Now().Add(m.gen_refresh)})
+    }
+}
@@ -0,0 +1,107 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  标签索引
+-------------------------------------------------
+*/
+
+package redis
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/query"
+)
+
+var _ cachedb.ITagCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextTagCacheDB = (*redisWrap)(nil)
+
+// 标签索引的key前缀, 标签索引是一个集合, 成员为数据的key
+const TagKeyPrefix = "zbec:tag:"
+
+// 添加成员, 标签索引的有效时间只会延长不会缩短, ARGV[2] 为 0 表示永不过期
+var addTagScript = rredis.NewScript(`
+local existed = redis.call("exists", KEYS[1])
+redis.call("sadd", KEYS[1], ARGV[1])
+local ex = tonumber(ARGV[2])
+if ex == 0 then
+    redis.call("persist", KEYS[1])
+    return 1
+end
+local ttl = redis.call("pttl", KEYS[1])
+if existed == 0 or (ttl >= 0 and ttl < ex) then
+    redis.call("pexpire", KEYS[1], ex)
+end
+return 1
+`)
+
+func (m *redisWrap) AddTags(query *query.Query, tags []string, ex time.Duration) error {
+    return m.AddTagsContext(context.Background(), query, tags, ex)
+}
+
+func (m *redisWrap) AddTagsContext(ctx context.Context, query *query.Query, tags []string, ex time.Duration) error {
+    key, err := m.key(ctx, query)
+    if err != nil {
+        return err
+    }
+
+    ms := int64(0)
+    if ex > 0 {
+        ms = int64(ex / time.Millisecond)
+        if ms == 0 {
+            ms = 1
+        }
+    }
+
+    err = m.do(ctx, "add_tags", func(c rredis.UniversalClient) error {
+        for _, tag := range tags {
+            if e := addTagScript.Run(c, []string{TagKeyPrefix + tag}, key, strconv.FormatInt(ms, 10)).Err(); e != nil {
+                return e
+            }
+        }
+        return nil
+    })
+    return zerrors.WithSimple(err)
+}
+
+func (m *redisWrap) DelTag(tag string) error {
+    return m.DelTagContext(context.Background(), tag)
+}
+
+func (m *redisWrap) DelTagContext(ctx context.Context, tag string) error {
+    tagKey := TagKeyPrefix + tag
+    err := m.do(ctx, "del_tag", func(c rredis.UniversalClient) error {
+        var cursor uint64
+        for {
+            keys, next, err := c.SScan(tagKey, cursor, "", m.scan_count).Result()
+            if err != nil {
+                return err
+            }
+
+            // 集群模式下不同slot的key不能在一个命令中删除, 所以逐个删除
+            if len(keys) > 0 {
+                pipe := c.Pipeline()
+                for _, key := range keys {
+                    pipe.Del(key)
+                }
+                if _, err = pipe.Exec(); err != nil {
+                    return err
+                }
+            }
+
+            if next == 0 {
+                break
+            }
+            cursor = next
+        }
+        return c.Del(tagKey).Err()
+    })
+    return zerrors.WithSimple(err)
+}
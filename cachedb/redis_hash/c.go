@@ -9,8 +9,10 @@
 package redis_hash
 
 import (
+    "context"
     "crypto/md5"
     "encoding/hex"
+    "io"
     "time"
 
     "github.com/afex/hystrix-go/hystrix"
@@ -21,21 +23,34 @@ import (
     "github.com/zlyuancn/zbec/codec"
     "github.com/zlyuancn/zbec/errs"
     "github.com/zlyuancn/zbec/query"
+    "github.com/zlyuancn/zbec/retry"
 )
 
-var _ cachedb.ICacheDB = (*redisWrap)(nil)
+var _ cachedb.IBatchCacheDB = (*redisWrap)(nil)
+var _ cachedb.ITTLCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextBatchCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextTTLCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextSpaceCacheDB = (*redisWrap)(nil)
+var _ cachedb.ICodecCacheDB = (*redisWrap)(nil)
+var _ io.Closer = (*redisWrap)(nil)
+var _ cachedb.IKeyCacheDB = (*redisWrap)(nil)
 
 type redisWrap struct {
     cdb        rredis.UniversalClient
     codec      codec.ICodec
+    codec_type codec.CodecType
     md5_params bool
     qfname     string // qf是断路器符号
+    observer   cachedb.Observer
+    retry      *retry.Policy
 }
 
 func Wrap(db rredis.UniversalClient, opts ...Option) cachedb.ICacheDB {
     m := &redisWrap{
         cdb:        db,
         codec:      codec.GetCodec(codec.DefaultCodecType),
+        codec_type: codec.DefaultCodecType,
         md5_params: true,
     }
     for _, o := range opts {
@@ -45,9 +60,13 @@ func Wrap(db rredis.UniversalClient, opts ...Option) cachedb.ICacheDB {
 }
 
 func (m *redisWrap) Set(query *query.Query, v interface{}, ex time.Duration) error {
+    return m.SetContext(context.Background(), query, v, ex)
+}
+
+func (m *redisWrap) SetContext(ctx context.Context, query *query.Query, v interface{}, ex time.Duration) error {
     if v == errs.NoEntry {
-        return m.do(func() error {
-            return m.cdb.HSet(query.Space(), m.makeKey(query), []byte{}).Err()
+        return m.do(ctx, "set", func(c rredis.UniversalClient) error {
+            return c.HSet(query.Space(), m.makeKey(query), []byte{}).Err()
         })
     }
 
@@ -55,17 +74,21 @@ func (m *redisWrap) Set(query *query.Query, v interface{}, ex time.Duration) err
     if err != nil {
         return zerrors.WrapSimplef(err, "编码失败 %T", v)
     }
-    return m.do(func() error {
-        return m.cdb.HSet(query.Space(), m.makeKey(query), bs).Err()
+    return m.do(ctx, "set", func(c rredis.UniversalClient) error {
+        return c.HSet(query.Space(), m.makeKey(query), bs).Err()
     })
 }
 
 func (m *redisWrap) Get(query *query.Query, a interface{}) (interface{}, error) {
+    return m.GetContext(context.Background(), query, a)
+}
+
+func (m *redisWrap) GetContext(ctx context.Context, query *query.Query, a interface{}) (interface{}, error) {
     var data []byte
     var err error
     empty := false
-    err = m.do(func() error {
-        bs, e := m.cdb.HGet(query.Space(), m.makeKey(query)).Bytes()
+    err = m.do(ctx, "get", func(c rredis.UniversalClient) error {
+        bs, e := c.HGet(query.Space(), m.makeKey(query)).Bytes()
         data = bs
         if e == rredis.Nil {
             empty = true
@@ -80,31 +103,100 @@ func (m *redisWrap) Get(query *query.Query, a interface{}) (interface{}, error)
     if empty {
         return nil, errs.ErrNoEntry
     }
-    if len(data) == 0 {
-        return nil, errs.NoEntry
-    }
+    return m.decode(data, a)
+}
+
+func (m *redisWrap) MGet(queries []*query.Query, as []interface{}) ([]interface{}, []error) {
+    return m.MGetContext(context.Background(), queries, as)
+}
+
+func (m *redisWrap) MGetContext(ctx context.Context, queries []*query.Query, as []interface{}) ([]interface{}, []error) {
+    outs := make([]interface{}, len(queries))
+    es := make([]error, len(queries))
+
+    var cmds []*rredis.StringCmd
+    err := m.do(ctx, "mget", func(c rredis.UniversalClient) error {
+        pipe := c.Pipeline()
+        cmds = make([]*rredis.StringCmd, len(queries))
+        for i, q := range queries {
+            cmds[i] = pipe.HGet(q.Space(), m.makeKey(q))
+        }
+        _, e := pipe.Exec()
+        if e == rredis.Nil {
+            return nil
+        }
+        return e
+    })
 
-    err = m.codec.Decode(data, a)
     if err != nil {
-        return nil, zerrors.WrapSimplef(err, "解码失败 %T", a)
+        err = zerrors.WithSimple(err)
+        for i := range es {
+            es[i] = err
+        }
+        return outs, es
     }
 
-    return a, nil
+    for i, cmd := range cmds {
+        data, e := cmd.Bytes()
+        if e == rredis.Nil {
+            es[i] = errs.ErrNoEntry
+            continue
+        }
+        if e != nil {
+            es[i] = zerrors.WithSimple(e)
+            continue
+        }
+        outs[i], es[i] = m.decode(data, as[i])
+    }
+    return outs, es
+}
+
+// hash的字段没有有效时间, 存在时总是返回 -1, 所以加载器的软过期和返回过期数据在redis_hash中不会生效
+func (m *redisWrap) TTL(query *query.Query) (time.Duration, error) {
+    return m.TTLContext(context.Background(), query)
+}
+
+func (m *redisWrap) TTLContext(ctx context.Context, query *query.Query) (time.Duration, error) {
+    var ok bool
+    err := m.do(ctx, "ttl", func(c rredis.UniversalClient) (e error) {
+        ok, e = c.HExists(query.Space(), m.makeKey(query)).Result()
+        return e
+    })
+    if err != nil {
+        return 0, zerrors.WithSimple(err)
+    }
+    if !ok {
+        return 0, errs.ErrNoEntry
+    }
+    return -1, nil
 }
 
 func (m *redisWrap) Del(query *query.Query) error {
-    return m.do(func() error {
-        err := m.cdb.HDel(query.Space(), m.makeKey(query)).Err()
-        if err == rredis.Nil {
-            return nil
+    return m.DelContext(context.Background(), query)
+}
+
+func (m *redisWrap) DelContext(ctx context.Context, query *query.Query) error {
+    return m.do(ctx, "del", func(c rredis.UniversalClient) error {
+        field := m.makeKey(query)
+        err := c.HDel(query.Space(), field).Err()
+        if err != nil && err != rredis.Nil {
+            return err
         }
-        return err
+        return delTagMembers(c, query.Space(), []string{field})
     })
 }
 
+// 删除空间数据前会扫描空间中的所有字段, 从标签索引中移除这些字段
 func (m *redisWrap) DelSpaceData(space string) error {
-    return m.do(func() error {
-        err := m.cdb.Del(space).Err()
+    return m.DelSpaceDataContext(context.Background(), space)
+}
+
+func (m *redisWrap) DelSpaceDataContext(ctx context.Context, space string) error {
+    return m.do(ctx, "del_space", func(c rredis.UniversalClient) error {
+        if err := delSpaceTagMembers(c, space); err != nil {
+            return err
+        }
+        err := c.Del(space).Err()
         if err == rredis.Nil {
             return nil
         }
@@ -112,8 +204,29 @@ func (m *redisWrap) DelSpaceData(space string) error {
     })
 }
 
+func (m *redisWrap) CodecType() codec.CodecType {
+    return m.codec_type
+}
+
+func (m *redisWrap) decode(data []byte, a interface{}) (interface{}, error) {
+    if len(data) == 0 {
+        return nil, errs.NoEntry
+    }
+
+    err := m.codec.Decode(data, a)
+    if err != nil {
+        return nil, zerrors.WrapSimplef(err, "解码失败 %T", a)
+    }
+    return a, nil
+}
+
 func (m *redisWrap) makeKey(query *query.Query) string {
-    if m.md5_params {
+    return MakeField(query, m.md5_params)
+}
+
+// 计算query在哈希表中的字段名, 哈希表的key为空间名, md5Params 与 WithMd5QueryParams 的设置相同
+func MakeField(query *query.Query, md5Params bool) string {
+    if md5Params {
         return string(makeMd5(query.Path()))
     }
     return query.Path()
@@ -128,9 +241,62 @@ func makeMd5(text string) []byte {
     return dst
 }
 
-func (m *redisWrap) do(fn func() error) error {
+func (m *redisWrap) do(ctx context.Context, op string, fn func(c rredis.UniversalClient) error) (err error) {
+    if err = ctx.Err(); err != nil {
+        return err
+    }
+
+    if m.observer != nil {
+        start := time.Now()
+        defer func() {
+            m.observer(op, time.Since(start), err)
+        }()
+    }
+
+    c := m.client(ctx)
+    if m.retry == nil {
+        return m.call(ctx, c, fn)
+    }
+    return m.retry.Do(ctx, func(ctx context.Context) error {
+        err := m.call(ctx, c, fn)
+        // 断路器拒绝的请求不需要重试
+        if err == hystrix.ErrCircuitOpen || err == hystrix.ErrMaxConcurrency {
+            return retry.Stop(err)
+        }
+        return err
+    })
+}
+
+func (m *redisWrap) call(ctx context.Context, c rredis.UniversalClient, fn func(c rredis.UniversalClient) error) error {
     if m.qfname == "" {
-        return fn()
+        return fn(c)
     }
-    return hystrix.Do(m.qfname, fn, nil)
+    return hystrix.DoC(ctx, m.qfname, func(context.Context) error {
+        return fn(c)
+    }, nil)
+}
+
+// 获取绑定了上下文的客户端, 上下文中的值可以被客户端的钩子读取
+func (m *redisWrap) client(ctx context.Context) rredis.UniversalClient {
+    if ctx == context.Background() {
+        return m.cdb
+    }
+
+    switch c := m.cdb.(type) {
+    case *rredis.Client:
+        return c.WithContext(ctx)
+    case *rredis.ClusterClient:
+        return c.WithContext(ctx)
+    }
+    return m.cdb
+}
+
+// 关闭redis客户端
+func (m *redisWrap) Close() error {
+    return m.cdb.Close()
+}
+
+// 获取query在redis中的字段名, 数据保存在以空间名为key的哈希表中
+func (m *redisWrap) CacheKey(query *query.Query) (string, error) {
+    return m.makeKey(query), nil
 }
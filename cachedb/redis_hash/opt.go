@@ -9,7 +9,9 @@
 package redis_hash
 
 import (
+    "github.com/zlyuancn/zbec/cachedb"
     "github.com/zlyuancn/zbec/codec"
+    "github.com/zlyuancn/zbec/retry"
 )
 
 type Option func(m *redisWrap)
@@ -18,6 +20,7 @@ type Option func(m *redisWrap)
 func WithCodecType(ctype codec.CodecType) Option {
     return func(m *redisWrap) {
         m.codec = codec.GetCodec(ctype)
+        m.codec_type = ctype
     }
 }
 
@@ -28,9 +31,24 @@ func WithHystrixName(qfname string) Option {
     }
 }
 
+// 设置重试策略, redis操作失败时会按策略重试, 断路器拒绝的请求不会重试
+// 所有操作都会重试, 重试可能会重复执行写入操作, 这些操作都是幂等的
+func WithRetry(policy *retry.Policy) Option {
+    return func(m *redisWrap) {
+        m.retry = policy
+    }
+}
+
 // 将query的params做md5, 默认为true
 func WithMd5QueryParams(b bool) Option {
     return func(m *redisWrap) {
         m.md5_params = b
     }
 }
+
+// 设置调用观察者, 每次调用redis后会将操作名丶耗时和错误告知观察者, 可以用于收集监控数据
+func WithObserver(observer cachedb.Observer) Option {
+    return func(m *redisWrap) {
+        m.observer = observer
+    }
+}
@@ -0,0 +1,158 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  标签索引
+-------------------------------------------------
+*/
+
+package redis_hash
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/query"
+)
+
+var _ cachedb.ITagCacheDB = (*redisWrap)(nil)
+var _ cachedb.IContextTagCacheDB = (*redisWrap)(nil)
+
+const (
+    // 标签索引的key前缀, 标签索引是一个集合, 成员由空间名和字段名组成
+    TagKeyPrefix = "zbec:tag:"
+    // 数据的标签集合的key前缀, 后面是标签索引的成员, 删除数据时用于从标签索引中移除成员
+    MemberTagsKeyPrefix = "zbec:member_tags:"
+    // 删除标签和删除空间数据时每批扫描的数量
+    tagScanCount = 500
+)
+
+// hash的字段没有有效时间, 所以标签索引也永不过期, 删除数据和删除空间数据时会从标签索引中移除成员, ex 会被忽略
+func (m *redisWrap) AddTags(query *query.Query, tags []string, ex time.Duration) error {
+    return m.AddTagsContext(context.Background(), query, tags, ex)
+}
+
+func (m *redisWrap) AddTagsContext(ctx context.Context, query *query.Query, tags []string, ex time.Duration) error {
+    member := makeTagMember(query.Space(), m.makeKey(query))
+    err := m.do(ctx, "add_tags", func(c rredis.UniversalClient) error {
+        pipe := c.Pipeline()
+        for _, tag := range tags {
+            pipe.SAdd(TagKeyPrefix+tag, member)
+            pipe.SAdd(MemberTagsKeyPrefix+member, tag)
+        }
+        _, err := pipe.Exec()
+        return err
+    })
+    return zerrors.WithSimple(err)
+}
+
+// 从数据的所有标签索引中移除成员
+func delTagMembers(c rredis.UniversalClient, space string, fields []string) error {
+    if len(fields) == 0 {
+        return nil
+    }
+
+    pipe := c.Pipeline()
+    cmds := make([]*rredis.StringSliceCmd, len(fields))
+    for i, field := range fields {
+        cmds[i] = pipe.SMembers(MemberTagsKeyPrefix + makeTagMember(space, field))
+    }
+    if _, err := pipe.Exec(); err != nil {
+        return err
+    }
+
+    pipe = c.Pipeline()
+    for i, field := range fields {
+        member := makeTagMember(space, field)
+        for _, tag := range cmds[i].Val() {
+            pipe.SRem(TagKeyPrefix+tag, member)
+        }
+        pipe.Del(MemberTagsKeyPrefix + member)
+    }
+    _, err := pipe.Exec()
+    return err
+}
+
+// 从空间中所有数据的标签索引中移除成员
+func delSpaceTagMembers(c rredis.UniversalClient, space string) error {
+    var cursor uint64
+    for {
+        kvs, next, err := c.HScan(space, cursor, "", tagScanCount).Result()
+        if err != nil {
+            return err
+        }
+
+        fields := make([]string, 0, len(kvs)/2)
+        for i := 0; i < len(kvs); i += 2 {
+            fields = append(fields, kvs[i])
+        }
+        if err = delTagMembers(c, space, fields); err != nil {
+            return err
+        }
+
+        if next == 0 {
+            return nil
+        }
+        cursor = next
+    }
+}
+
+func (m *redisWrap) DelTag(tag string) error {
+    return m.DelTagContext(context.Background(), tag)
+}
+
+func (m *redisWrap) DelTagContext(ctx context.Context, tag string) error {
+    tagKey := TagKeyPrefix + tag
+    err := m.do(ctx, "del_tag", func(c rredis.UniversalClient) error {
+        var cursor uint64
+        for {
+            members, next, err := c.SScan(tagKey, cursor, "", tagScanCount).Result()
+            if err != nil {
+                return err
+            }
+
+            if len(members) > 0 {
+                pipe := c.Pipeline()
+                for _, member := range members {
+                    if space, field, ok := parseTagMember(member); ok {
+                        pipe.HDel(space, field)
+                        pipe.SRem(MemberTagsKeyPrefix+member, tag)
+                    }
+                }
+                if _, err = pipe.Exec(); err != nil {
+                    return err
+                }
+            }
+
+            if next == 0 {
+                break
+            }
+            cursor = next
+        }
+        return c.Del(tagKey).Err()
+    })
+    return zerrors.WithSimple(err)
+}
+
+// 生成标签索引的成员, 格式为 空间名长度:空间名字段名
+func makeTagMember(space, field string) string {
+    return strconv.Itoa(len(space)) + ":" + space + field
+}
+
+func parseTagMember(member string) (space, field string, ok bool) {
+    i := strings.IndexByte(member, ':')
+    if i < 0 {
+        return "", "", false
+    }
+    n, err := strconv.Atoi(member[:i])
+    if err != nil || n < 0 || i+1+n > len(member) {
+        return "", "", false
+    }
+    return member[i+1 : i+1+n], member[i+1+n:], true
+}
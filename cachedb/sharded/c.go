@@ -0,0 +1,296 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  分片的内存缓存
+-------------------------------------------------
+*/
+
+package sharded
+
+import (
+    "runtime"
+    "sync"
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/errs"
+    "github.com/zlyuancn/zbec/query"
+)
+
+const (
+    // 默认分片数量
+    DefaultShards = 64
+    // 默认时间轮的刻度
+    DefaultTick = time.Second
+    // 默认时间轮的槽数量
+    DefaultWheelSlots = 64
+)
+
+var _ cachedb.ITTLCacheDB = (*Cache)(nil)
+var _ cachedb.IClearCacheDB = (*Cache)(nil)
+
+type item struct {
+    space  string
+    path   string
+    value  interface{}
+    expire int64 // 过期时间的纳秒时间戳, 0表示永不过期
+    slot   int   // 所在的时间轮槽, -1表示不在时间轮中
+}
+
+// 分片
+type shard struct {
+    spaces map[string]map[string]*item
+    wheel  []map[*item]struct{}
+    mx     sync.RWMutex
+}
+
+// 分片的内存缓存, 根据 query.FullPath() 的哈希值将数据分散到多个独立加锁的分片中
+//
+// 每个分片有自己的时间轮, 后台每个刻度清理一个槽中过期的条目, 获取时也会检查是否过期
+// 后台goroutine只引用内部的 cache, Cache 不再被引用时会自动停止后台goroutine
+type Cache struct {
+    *cache
+}
+
+type cache struct {
+    shard_count int
+    shards      []*shard
+    mask        uint64
+    tick        time.Duration
+    slots       int
+
+    cursor int
+    done   chan struct{}
+    once   sync.Once
+}
+
+func New(opts ...Option) *Cache {
+    m := &Cache{&cache{
+        shard_count: DefaultShards,
+        tick:        DefaultTick,
+        slots:       DefaultWheelSlots,
+        done:        make(chan struct{}),
+    }}
+    for _, o := range opts {
+        o(m)
+    }
+
+    // 分片数量向上取整为2的幂
+    size := 1
+    for size < m.shard_count {
+        size <<= 1
+    }
+    m.mask = uint64(size - 1)
+    m.shards = make([]*shard, size)
+    for i := range m.shards {
+        s := &shard{
+            spaces: make(map[string]map[string]*item),
+            wheel:  make([]map[*item]struct{}, m.slots),
+        }
+        for j := range s.wheel {
+            s.wheel[j] = make(map[*item]struct{})
+        }
+        m.shards[i] = s
+    }
+
+    go m.cache.run()
+    runtime.SetFinalizer(m, stopCache)
+    return m
+}
+
+// Cache 被回收时停止后台goroutine
+func stopCache(m *Cache) {
+    _ = m.Close()
+}
+
+func (m *cache) Set(query *query.Query, v interface{}, ex time.Duration) error {
+    it := &item{space: query.Space(), path: query.Path(), value: v, slot: -1}
+    if ex > 0 {
+        it.expire = time.Now().Add(ex).UnixNano()
+        // 放到过期时间所在刻度的下一个槽, 清理这个槽时条目一定已经过期
+        it.slot = int(it.expire/int64(m.tick)+1) % m.slots
+    }
+
+    s := m.shard(query)
+    s.mx.Lock()
+    paths, ok := s.spaces[query.Space()]
+    if !ok {
+        paths = make(map[string]*item)
+        s.spaces[query.Space()] = paths
+    }
+    if old, ok := paths[query.Path()]; ok && old.slot >= 0 {
+        delete(s.wheel[old.slot], old)
+    }
+    paths[query.Path()] = it
+    if it.slot >= 0 {
+        s.wheel[it.slot][it] = struct{}{}
+    }
+    s.mx.Unlock()
+    return nil
+}
+
+func (m *cache) Get(query *query.Query, a interface{}) (interface{}, error) {
+    it, ok := m.get(query)
+    if !ok {
+        return nil, errs.ErrNoEntry
+    }
+    if it.value == errs.NoEntry {
+        return nil, errs.NoEntry
+    }
+    return it.value, nil
+}
+
+func (m *cache) TTL(query *query.Query) (time.Duration, error) {
+    it, ok := m.get(query)
+    if !ok {
+        return 0, errs.ErrNoEntry
+    }
+    if it.expire == 0 {
+        return -1, nil
+    }
+    return time.Duration(it.expire - time.Now().UnixNano()), nil
+}
+
+func (m *cache) Del(query *query.Query) error {
+    s := m.shard(query)
+    s.mx.Lock()
+    s.del(query.Space(), query.Path())
+    s.mx.Unlock()
+    return nil
+}
+
+func (m *cache) DelSpaceData(space string) error {
+    for _, s := range m.shards {
+        s.mx.Lock()
+        for _, it := range s.spaces[space] {
+            if it.slot >= 0 {
+                delete(s.wheel[it.slot], it)
+            }
+        }
+        delete(s.spaces, space)
+        s.mx.Unlock()
+    }
+    return nil
+}
+
+func (m *cache) Clear() error {
+    for _, s := range m.shards {
+        s.mx.Lock()
+        s.spaces = make(map[string]map[string]*item)
+        for i := range s.wheel {
+            s.wheel[i] = make(map[*item]struct{})
+        }
+        s.mx.Unlock()
+    }
+    return nil
+}
+
+// 获取条目总数量
+func (m *cache) Len() int {
+    n := 0
+    for _, s := range m.shards {
+        s.mx.RLock()
+        for _, paths := range s.spaces {
+            n += len(paths)
+        }
+        s.mx.RUnlock()
+    }
+    return n
+}
+
+// 停止后台清理
+func (m *cache) Close() error {
+    m.once.Do(func() {
+        close(m.done)
+    })
+    return nil
+}
+
+// 获取未过期的条目
+func (m *cache) get(query *query.Query) (*item, bool) {
+    s := m.shard(query)
+    s.mx.RLock()
+    it, ok := s.spaces[query.Space()][query.Path()]
+    s.mx.RUnlock()
+
+    if !ok || (it.expire > 0 && time.Now().UnixNano() >= it.expire) {
+        return nil, false
+    }
+    return it, true
+}
+
+func (m *cache) shard(query *query.Query) *shard {
+    return m.shards[hashString(query.FullPath())&m.mask]
+}
+
+// 每个刻度清理所有分片中当前槽的过期条目, 没有过期的条目会在时间轮转完一圈后再次检查
+func (m *cache) run() {
+    t := time.NewTicker(m.tick)
+    defer t.Stop()
+
+    m.cursor = int(time.Now().UnixNano()/int64(m.tick)) % m.slots
+    for {
+        select {
+        case <-m.done:
+            return
+        case now := <-t.C:
+            // 清理从上次位置到当前位置之间的所有槽, 避免刻度被跳过时漏掉
+            target := int(now.UnixNano()/int64(m.tick)) % m.slots
+            for {
+                for _, s := range m.shards {
+                    s.expire(m.cursor, now.UnixNano())
+                }
+                if m.cursor == target {
+                    break
+                }
+                m.cursor = (m.cursor + 1) % m.slots
+            }
+        }
+    }
+}
+
+// 清理槽中过期的条目
+func (s *shard) expire(slot int, now int64) {
+    s.mx.Lock()
+    for it := range s.wheel[slot] {
+        if it.expire > now {
+            continue
+        }
+        delete(s.wheel[slot], it)
+
+        if paths, ok := s.spaces[it.space]; ok && paths[it.path] == it {
+            delete(paths, it.path)
+            if len(paths) == 0 {
+                delete(s.spaces, it.space)
+            }
+        }
+    }
+    s.mx.Unlock()
+}
+
+func (s *shard) del(space, path string) {
+    paths, ok := s.spaces[space]
+    if !ok {
+        return
+    }
+    if it, ok := paths[path]; ok {
+        if it.slot >= 0 {
+            delete(s.wheel[it.slot], it)
+        }
+        delete(paths, path)
+        if len(paths) == 0 {
+            delete(s.spaces, space)
+        }
+    }
+}
+
+// fnv-1a, 避免将字符串转为[]byte产生内存分配
+func hashString(s string) uint64 {
+    h := uint64(14695981039346656037)
+    for i := 0; i < len(s); i++ {
+        h ^= uint64(s[i])
+        h *= 1099511628211
+    }
+    return h
+}
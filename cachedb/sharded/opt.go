@@ -0,0 +1,37 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package sharded
+
+import (
+    "time"
+)
+
+type Option func(m *Cache)
+
+// 设置分片数量, 会向上取整为2的幂, 默认为 64
+func WithShards(n int) Option {
+    return func(m *Cache) {
+        if n > 0 {
+            m.shard_count = n
+        }
+    }
+}
+
+// 设置时间轮的刻度和槽数量, 默认为 1秒 和 64
+// 每个刻度清理一个槽, 过期的条目最多在 tick 之后被清理, 有效时间超过 tick*slots 的条目会被多次检查
+func WithWheel(tick time.Duration, slots int) Option {
+    return func(m *Cache) {
+        if tick > 0 {
+            m.tick = tick
+        }
+        if slots > 0 {
+            m.slots = slots
+        }
+    }
+}
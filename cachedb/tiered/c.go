@@ -0,0 +1,303 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  多层缓存组合
+-------------------------------------------------
+*/
+
+package tiered
+
+import (
+    "context"
+    "errors"
+    "io"
+    "time"
+
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/errs"
+    "github.com/zlyuancn/zbec/query"
+)
+
+// 这一层不支持获取剩余有效时间
+var errNoTTL = errors.New("不支持获取剩余有效时间")
+
+var _ cachedb.ITTLCacheDB = (*Cache)(nil)
+var _ cachedb.IContextCacheDB = (*Cache)(nil)
+var _ cachedb.IContextTTLCacheDB = (*Cache)(nil)
+var _ cachedb.ITagCacheDB = (*Cache)(nil)
+var _ io.Closer = (*Cache)(nil)
+var _ cachedb.ITieredCacheDB = (*Cache)(nil)
+
+// 写入策略
+type WritePolicy int
+
+const (
+    // 从最底层开始写入所有层
+    WriteAll WritePolicy = iota
+    // 只写入最底层并删除上层的数据, 上层在获取时回填
+    WriteInvalidateUpper
+    // 只写入最底层, 上层的数据在过期后才会更新
+    WriteBottomOnly
+)
+
+// 删除策略
+type DeletePolicy int
+
+const (
+    // 从最底层开始删除所有层
+    DeleteAll DeletePolicy = iota
+    // 只删除最底层, 上层的数据在过期后才会删除
+    DeleteBottomOnly
+)
+
+type tier struct {
+    cdb cachedb.ICacheDB
+    ex  time.Duration
+}
+
+// 多层缓存, 按添加顺序从上到下查找, 下层命中时回填上层
+//
+//  cdb := tiered.New(
+//      tiered.WithTier(lru.New(), time.Second),
+//      tiered.WithTier(redis.Wrap(nodeClient), time.Minute),
+//      tiered.WithTier(redis.Wrap(clusterClient), 0),
+//  )
+type Cache struct {
+    tiers        []tier
+    write_policy WritePolicy
+    del_policy   DeletePolicy
+}
+
+func New(opts ...Option) *Cache {
+    m := new(Cache)
+    for _, o := range opts {
+        o(m)
+    }
+    if len(m.tiers) == 0 {
+        panic("至少需要一层缓存")
+    }
+    return m
+}
+
+func (m *Cache) Set(query *query.Query, v interface{}, ex time.Duration) error {
+    return m.SetContext(context.Background(), query, v, ex)
+}
+
+func (m *Cache) SetContext(ctx context.Context, query *query.Query, v interface{}, ex time.Duration) error {
+    bottom := len(m.tiers) - 1
+    if err := setTier(ctx, m.tiers[bottom], query, v, ex); err != nil {
+        return zerrors.WithMessagef(err, "写入第%d层失败", bottom)
+    }
+
+    var err error
+    for i := bottom - 1; i >= 0; i-- {
+        var e error
+        switch m.write_policy {
+        case WriteAll:
+            e = setTier(ctx, m.tiers[i], query, v, ex)
+        case WriteInvalidateUpper:
+            e = delTier(ctx, m.tiers[i], query)
+        }
+        if e != nil && err == nil {
+            err = zerrors.WithMessagef(e, "写入第%d层失败", i)
+        }
+    }
+    return err
+}
+
+func (m *Cache) Get(query *query.Query, a interface{}) (interface{}, error) {
+    return m.GetContext(context.Background(), query, a)
+}
+
+func (m *Cache) GetContext(ctx context.Context, query *query.Query, a interface{}) (interface{}, error) {
+    for i, t := range m.tiers {
+        out, err := getTier(ctx, t, query, a)
+        if err == errs.ErrNoEntry {
+            continue
+        }
+        if err != nil && err != errs.NoEntry {
+            return nil, zerrors.WithMessagef(err, "读取第%d层失败", i)
+        }
+
+        if i > 0 {
+            v := out
+            if err == errs.NoEntry {
+                v = errs.NoEntry
+            }
+            m.backfill(ctx, i, query, v)
+        }
+        return out, err
+    }
+    return nil, errs.ErrNoEntry
+}
+
+// 返回最下层的剩余有效时间, 上层的有效时间受每层的设置限制, 不能代表数据的有效时间
+func (m *Cache) TTL(query *query.Query) (time.Duration, error) {
+    return m.TTLContext(context.Background(), query)
+}
+
+func (m *Cache) TTLContext(ctx context.Context, query *query.Query) (time.Duration, error) {
+    for i := len(m.tiers) - 1; i >= 0; i-- {
+        ttl, err := ttlTier(ctx, m.tiers[i], query)
+        if err == errNoTTL || err == errs.ErrNoEntry {
+            continue
+        }
+        if err != nil {
+            return 0, zerrors.WithMessagef(err, "读取第%d层失败", i)
+        }
+        return ttl, nil
+    }
+    return 0, errs.ErrNoEntry
+}
+
+func (m *Cache) Del(query *query.Query) error {
+    return m.DelContext(context.Background(), query)
+}
+
+func (m *Cache) DelContext(ctx context.Context, query *query.Query) error {
+    return m.eachDelTier(func(t tier) error {
+        return delTier(ctx, t, query)
+    })
+}
+
+func (m *Cache) DelSpaceData(space string) error {
+    return m.eachDelTier(func(t tier) error {
+        return t.cdb.DelSpaceData(space)
+    })
+}
+
+// 为所有支持标签的层添加标签
+func (m *Cache) AddTags(query *query.Query, tags []string, ex time.Duration) error {
+    for i, t := range m.tiers {
+        tc, ok := t.cdb.(cachedb.ITagCacheDB)
+        if !ok {
+            continue
+        }
+        if err := tc.AddTags(query, tags, tierExpire(t, ex)); err != nil {
+            return zerrors.WithMessagef(err, "第%d层添加标签失败", i)
+        }
+    }
+    return nil
+}
+
+// 删除所有支持标签的层中标签关联的数据, 不受删除策略影响
+func (m *Cache) DelTag(tag string) error {
+    var err error
+    for i := len(m.tiers) - 1; i >= 0; i-- {
+        tc, ok := m.tiers[i].cdb.(cachedb.ITagCacheDB)
+        if !ok {
+            continue
+        }
+        if e := tc.DelTag(tag); e != nil && err == nil {
+            err = zerrors.WithMessagef(e, "第%d层删除标签失败", i)
+        }
+    }
+    return err
+}
+
+// 获取所有层, 按查找顺序从上到下排列
+func (m *Cache) Tiers() []cachedb.ICacheDB {
+    out := make([]cachedb.ICacheDB, len(m.tiers))
+    for i, t := range m.tiers {
+        out[i] = t.cdb
+    }
+    return out
+}
+
+// 关闭所有实现了 io.Closer 的层, 返回第一个错误
+func (m *Cache) Close() error {
+    var err error
+    for i, t := range m.tiers {
+        c, ok := t.cdb.(io.Closer)
+        if !ok {
+            continue
+        }
+        if e := c.Close(); e != nil && err == nil {
+            err = zerrors.WithMessagef(e, "关闭第%d层失败", i)
+        }
+    }
+    return err
+}
+
+// 将下层命中的数据回填到上层, 有效时间为上层的有效时间, 下层支持获取剩余有效时间时不会超过剩余有效时间
+func (m *Cache) backfill(ctx context.Context, hit int, query *query.Query, v interface{}) {
+    remaining := time.Duration(-1)
+    if ttl, err := ttlTier(ctx, m.tiers[hit], query); err == nil {
+        remaining = ttl
+    }
+
+    for i := hit - 1; i >= 0; i-- {
+        ex := m.tiers[i].ex
+        if remaining > 0 && (ex <= 0 || ex > remaining) {
+            ex = remaining
+        }
+        // 无法确定有效时间时不回填, 避免上层的数据永不过期
+        if ex <= 0 {
+            continue
+        }
+        _ = setTier(ctx, m.tiers[i], query, v, ex)
+    }
+}
+
+// 按删除策略从最底层开始删除, 返回第一个错误
+func (m *Cache) eachDelTier(fn func(t tier) error) error {
+    bottom := len(m.tiers) - 1
+    if err := fn(m.tiers[bottom]); err != nil {
+        return zerrors.WithMessagef(err, "删除第%d层失败", bottom)
+    }
+    if m.del_policy == DeleteBottomOnly {
+        return nil
+    }
+
+    var err error
+    for i := bottom - 1; i >= 0; i-- {
+        if e := fn(m.tiers[i]); e != nil && err == nil {
+            err = zerrors.WithMessagef(e, "删除第%d层失败", i)
+        }
+    }
+    return err
+}
+
+// 计算写入这一层的有效时间, 取这一层的有效时间和调用者的有效时间中较小的
+func tierExpire(t tier, ex time.Duration) time.Duration {
+    if t.ex > 0 && (ex <= 0 || t.ex < ex) {
+        return t.ex
+    }
+    return ex
+}
+
+func setTier(ctx context.Context, t tier, query *query.Query, v interface{}, ex time.Duration) error {
+    ex = tierExpire(t, ex)
+    if c, ok := t.cdb.(cachedb.IContextCacheDB); ok {
+        return c.SetContext(ctx, query, v, ex)
+    }
+    return t.cdb.Set(query, v, ex)
+}
+
+func getTier(ctx context.Context, t tier, query *query.Query, a interface{}) (interface{}, error) {
+    if c, ok := t.cdb.(cachedb.IContextCacheDB); ok {
+        return c.GetContext(ctx, query, a)
+    }
+    return t.cdb.Get(query, a)
+}
+
+func delTier(ctx context.Context, t tier, query *query.Query) error {
+    if c, ok := t.cdb.(cachedb.IContextCacheDB); ok {
+        return c.DelContext(ctx, query)
+    }
+    return t.cdb.Del(query)
+}
+
+// 获取这一层的剩余有效时间, 这一层不支持获取剩余有效时间时返回 errNoTTL
+func ttlTier(ctx context.Context, t tier, query *query.Query) (time.Duration, error) {
+    if c, ok := t.cdb.(cachedb.IContextTTLCacheDB); ok {
+        return c.TTLContext(ctx, query)
+    }
+    if c, ok := t.cdb.(cachedb.ITTLCacheDB); ok {
+        return c.TTL(query)
+    }
+    return 0, errNoTTL
+}
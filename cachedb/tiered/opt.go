@@ -0,0 +1,42 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package tiered
+
+import (
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+type Option func(m *Cache)
+
+// 添加一层缓存, 先添加的在上层
+// ex 为这一层的有效时间, 写入时取 ex 和调用者的有效时间中较小的, 为0表示使用调用者的有效时间
+func WithTier(cdb cachedb.ICacheDB, ex time.Duration) Option {
+    return func(m *Cache) {
+        if cdb == nil {
+            panic("缓存数据库是空的")
+        }
+        m.tiers = append(m.tiers, tier{cdb: cdb, ex: ex})
+    }
+}
+
+// 设置写入策略, 默认为 WriteAll
+func WithWritePolicy(policy WritePolicy) Option {
+    return func(m *Cache) {
+        m.write_policy = policy
+    }
+}
+
+// 设置删除策略, 默认为 DeleteAll
+func WithDeletePolicy(policy DeletePolicy) Option {
+    return func(m *Cache) {
+        m.del_policy = policy
+    }
+}
@@ -0,0 +1,294 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  W-TinyLFU本地缓存
+-------------------------------------------------
+*/
+
+package tinylfu
+
+import (
+    "container/list"
+    "hash/fnv"
+    "sync"
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/errs"
+    "github.com/zlyuancn/zbec/query"
+)
+
+// 默认最大条目数量
+const DefaultMaxEntries = 10000
+
+var _ cachedb.ITTLCacheDB = (*Cache)(nil)
+var _ cachedb.IPeekCacheDB = (*Cache)(nil)
+var _ cachedb.IClearCacheDB = (*Cache)(nil)
+
+// 条目所在的区域
+const (
+    inWindow = iota
+    inProbation
+    inProtected
+)
+
+type entry struct {
+    space  string
+    path   string
+    hash   uint64
+    value  interface{}
+    expire time.Time // 零值表示永不过期
+    region int
+}
+
+// W-TinyLFU缓存
+//
+// 新条目先进入容量为1%的窗口区, 窗口区淘汰的条目只有访问频率高于主区的淘汰者时才会进入主区,
+// 主区分为试用区和保护区, 试用区的条目再次被访问后进入保护区. 只访问一次的条目不会挤掉热点条目
+type Cache struct {
+    capacity      int
+    window_cap    int
+    protected_cap int
+
+    window    *list.List
+    probation *list.List
+    protected *list.List
+    spaces    map[string]map[string]*list.Element
+    sketch    *sketch
+    mx        sync.Mutex
+}
+
+func New(opts ...Option) *Cache {
+    m := &Cache{
+        capacity:  DefaultMaxEntries,
+        window:    list.New(),
+        probation: list.New(),
+        protected: list.New(),
+        spaces:    make(map[string]map[string]*list.Element),
+    }
+    for _, o := range opts {
+        o(m)
+    }
+
+    m.window_cap = m.capacity / 100
+    if m.window_cap < 1 {
+        m.window_cap = 1
+    }
+    m.protected_cap = (m.capacity - m.window_cap) * 8 / 10
+    m.sketch = newSketch(m.capacity)
+    return m
+}
+
+func (m *Cache) Set(query *query.Query, v interface{}, ex time.Duration) error {
+    var expire time.Time
+    if ex > 0 {
+        expire = time.Now().Add(ex)
+    }
+    hash := hashQuery(query)
+
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    // 访问频率只由 Get 记录, 写入不算访问
+    if el, ok := m.lookup(query); ok {
+        e := el.Value.(*entry)
+        e.value, e.expire = v, expire
+        return nil
+    }
+
+    e := &entry{space: query.Space(), path: query.Path(), hash: hash, value: v, expire: expire, region: inWindow}
+    m.index(e.space)[e.path] = m.window.PushFront(e)
+    if m.window.Len() > m.window_cap {
+        m.admit(m.window.Back())
+    }
+    return nil
+}
+
+func (m *Cache) Get(query *query.Query, a interface{}) (interface{}, error) {
+    hash := hashQuery(query)
+
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    m.sketch.add(hash)
+    el, ok := m.get(query)
+    if !ok {
+        return nil, errs.ErrNoEntry
+    }
+
+    m.touch(el)
+    out := el.Value.(*entry).value
+    if out == errs.NoEntry {
+        return nil, errs.NoEntry
+    }
+    return out, nil
+}
+
+func (m *Cache) Peek(query *query.Query, a interface{}) (interface{}, error) {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    el, ok := m.get(query)
+    if !ok {
+        return nil, errs.ErrNoEntry
+    }
+
+    out := el.Value.(*entry).value
+    if out == errs.NoEntry {
+        return nil, errs.NoEntry
+    }
+    return out, nil
+}
+
+func (m *Cache) TTL(query *query.Query) (time.Duration, error) {
+    m.mx.Lock()
+    defer m.mx.Unlock()
+
+    el, ok := m.get(query)
+    if !ok {
+        return 0, errs.ErrNoEntry
+    }
+
+    e := el.Value.(*entry)
+    if e.expire.IsZero() {
+        return -1, nil
+    }
+    return time.Until(e.expire), nil
+}
+
+func (m *Cache) Del(query *query.Query) error {
+    m.mx.Lock()
+    if el, ok := m.lookup(query); ok {
+        m.remove(el)
+    }
+    m.mx.Unlock()
+    return nil
+}
+
+func (m *Cache) DelSpaceData(space string) error {
+    m.mx.Lock()
+    for _, el := range m.spaces[space] {
+        m.remove(el)
+    }
+    m.mx.Unlock()
+    return nil
+}
+
+// 清除所有数据, 保留访问频率
+func (m *Cache) Clear() error {
+    m.mx.Lock()
+    m.window.Init()
+    m.probation.Init()
+    m.protected.Init()
+    m.spaces = make(map[string]map[string]*list.Element)
+    m.mx.Unlock()
+    return nil
+}
+
+// 获取条目总数量
+func (m *Cache) Len() int {
+    m.mx.Lock()
+    n := m.window.Len() + m.probation.Len() + m.protected.Len()
+    m.mx.Unlock()
+    return n
+}
+
+// 窗口区淘汰的候选者和主区的淘汰者比较访问频率, 频率低的被淘汰
+func (m *Cache) admit(el *list.Element) {
+    candidate := m.window.Remove(el).(*entry)
+    if m.probation.Len()+m.protected.Len() < m.capacity-m.window_cap {
+        candidate.region = inProbation
+        m.spaces[candidate.space][candidate.path] = m.probation.PushFront(candidate)
+        return
+    }
+
+    victim := m.probation.Back()
+    if victim == nil {
+        victim = m.protected.Back()
+    }
+    if victim == nil || m.sketch.estimate(candidate.hash) <= m.sketch.estimate(victim.Value.(*entry).hash) {
+        m.unindex(candidate)
+        return
+    }
+
+    m.remove(victim)
+    candidate.region = inProbation
+    m.spaces[candidate.space][candidate.path] = m.probation.PushFront(candidate)
+}
+
+// 条目被访问, 试用区的条目进入保护区, 保护区满了之后最久没有访问的条目回到试用区
+func (m *Cache) touch(el *list.Element) {
+    e := el.Value.(*entry)
+    switch e.region {
+    case inWindow:
+        m.window.MoveToFront(el)
+    case inProtected:
+        m.protected.MoveToFront(el)
+    case inProbation:
+        m.probation.Remove(el)
+        e.region = inProtected
+        m.spaces[e.space][e.path] = m.protected.PushFront(e)
+        if m.protected.Len() > m.protected_cap {
+            demoted := m.protected.Remove(m.protected.Back()).(*entry)
+            demoted.region = inProbation
+            m.spaces[demoted.space][demoted.path] = m.probation.PushFront(demoted)
+        }
+    }
+}
+
+// 获取未过期的条目, 过期的条目会被删除
+func (m *Cache) get(query *query.Query) (*list.Element, bool) {
+    el, ok := m.lookup(query)
+    if !ok {
+        return nil, false
+    }
+
+    e := el.Value.(*entry)
+    if !e.expire.IsZero() && time.Now().After(e.expire) {
+        m.remove(el)
+        return nil, false
+    }
+    return el, true
+}
+
+func (m *Cache) lookup(query *query.Query) (*list.Element, bool) {
+    el, ok := m.spaces[query.Space()][query.Path()]
+    return el, ok
+}
+
+func (m *Cache) index(space string) map[string]*list.Element {
+    s, ok := m.spaces[space]
+    if !ok {
+        s = make(map[string]*list.Element)
+        m.spaces[space] = s
+    }
+    return s
+}
+
+func (m *Cache) unindex(e *entry) {
+    s := m.spaces[e.space]
+    delete(s, e.path)
+    if len(s) == 0 {
+        delete(m.spaces, e.space)
+    }
+}
+
+func (m *Cache) remove(el *list.Element) {
+    e := el.Value.(*entry)
+    switch e.region {
+    case inWindow:
+        m.window.Remove(el)
+    case inProbation:
+        m.probation.Remove(el)
+    case inProtected:
+        m.protected.Remove(el)
+    }
+    m.unindex(e)
+}
+
+func hashQuery(query *query.Query) uint64 {
+    h := fnv.New64a()
+    _, _ = h.Write([]byte(query.FullPath()))
+    return h.Sum64()
+}
@@ -0,0 +1,20 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package tinylfu
+
+type Option func(m *Cache)
+
+// 设置最大条目数量, 默认为 10000
+func WithMaxEntries(n int) Option {
+    return func(m *Cache) {
+        if n > 0 {
+            m.capacity = n
+        }
+    }
+}
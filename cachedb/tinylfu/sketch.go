@@ -0,0 +1,76 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  访问频率估算
+-------------------------------------------------
+*/
+
+package tinylfu
+
+// 计数器上限
+const maxCount = 15
+
+// 计算的行数, 每行使用不同的种子
+var sketchSeeds = [...]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// count-min sketch, 计数器达到上限后不再增加, 增加次数达到阈值后所有计数器减半, 让旧的访问频率逐渐衰减
+type sketch struct {
+    rows      [len(sketchSeeds)][]uint8
+    mask      uint64
+    additions int
+    reset_at  int
+}
+
+func newSketch(capacity int) *sketch {
+    width := 16
+    for width < capacity {
+        width <<= 1
+    }
+
+    s := &sketch{mask: uint64(width - 1), reset_at: width * 10}
+    for i := range s.rows {
+        s.rows[i] = make([]uint8, width)
+    }
+    return s
+}
+
+func (s *sketch) index(hash uint64, i int) uint64 {
+    h := (hash ^ sketchSeeds[i]) * 0x9e3779b97f4a7c15
+    return (h ^ h>>32) & s.mask
+}
+
+// 增加一次访问
+func (s *sketch) add(hash uint64) {
+    for i := range s.rows {
+        idx := s.index(hash, i)
+        if s.rows[i][idx] < maxCount {
+            s.rows[i][idx]++
+        }
+    }
+
+    s.additions++
+    if s.additions >= s.reset_at {
+        s.reset()
+    }
+}
+
+// 估算访问频率
+func (s *sketch) estimate(hash uint64) uint8 {
+    min := uint8(maxCount)
+    for i := range s.rows {
+        if c := s.rows[i][s.index(hash, i)]; c < min {
+            min = c
+        }
+    }
+    return min
+}
+
+func (s *sketch) reset() {
+    for i := range s.rows {
+        for j := range s.rows[i] {
+            s.rows[i][j] >>= 1
+        }
+    }
+    s.additions /= 2
+}
@@ -0,0 +1,63 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  加载器断路器
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+
+    "github.com/afex/hystrix-go/hystrix"
+)
+
+// 断路器打开时调用的降级函数, err 为断路器返回的错误
+// 返回的数据不会写入缓存, 返回错误时如果加载器设置了过期数据保留时间会返回过期数据
+type FallbackFn func(ctx context.Context, query *Query, err error) (interface{}, error)
+
+// 使用断路器的加载器
+type ICircuitLoader interface {
+    ILoader
+    // 断路器名, 空名称表示不使用断路器
+    CircuitName() string
+    // 断路器打开时调用, 返回的数据不会写入缓存
+    CircuitFallback(ctx context.Context, query *Query, err error) (interface{}, error)
+}
+
+// 通过断路器调用fn, ErrNoEntry 不会被断路器视为错误
+func (m *BECache) circuit(ctx context.Context, loader ILoader, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+    cloader, ok := loader.(ICircuitLoader)
+    if !ok || cloader.CircuitName() == "" {
+        return fn(ctx)
+    }
+
+    var out interface{}
+    var ferr error
+    err := hystrix.DoC(ctx, cloader.CircuitName(), func(ctx context.Context) error {
+        out, ferr = fn(ctx)
+        if ferr == ErrNoEntry {
+            return nil
+        }
+        return ferr
+    }, nil)
+    // 只有fn执行完成时才能读取结果, 其它情况fn可能还在执行
+    if err != nil {
+        return nil, err
+    }
+    return out, ferr
+}
+
+// 断路器打开或并发已满时返回加载器的降级函数
+func circuitFallback(loader ILoader, err error) (FallbackFn, bool) {
+    if err != hystrix.ErrCircuitOpen && err != hystrix.ErrMaxConcurrency {
+        return nil, false
+    }
+    cloader, ok := loader.(ICircuitLoader)
+    if !ok {
+        return nil, false
+    }
+    return cloader.CircuitFallback, true
+}
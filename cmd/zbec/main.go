@@ -0,0 +1,268 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  redis缓存查看工具
+-------------------------------------------------
+*/
+
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    rredis "github.com/go-redis/redis"
+
+    "github.com/zlyuancn/zbec/cachedb"
+    "github.com/zlyuancn/zbec/cachedb/redis"
+    "github.com/zlyuancn/zbec/cachedb/redis_hash"
+    "github.com/zlyuancn/zbec/codec"
+    "github.com/zlyuancn/zbec/errs"
+    "github.com/zlyuancn/zbec/query"
+)
+
+const usage = `用法: zbec [选项] <命令> <空间名> [参数...]
+
+命令:
+  get          获取数据, 解码后以json输出
+  del          删除数据
+  ttl          获取数据的剩余有效时间
+  scan-space   列出空间的所有key
+  flush-space  删除空间的所有数据, 需要 -yes
+
+选项:
+`
+
+type config struct {
+    addrs      string
+    password   string
+    db         int
+    mode       string
+    md5        bool
+    codec      string
+    generation bool
+    scan_count int64
+    yes        bool
+}
+
+func main() {
+    var c config
+    fs := flag.NewFlagSet("zbec", flag.ExitOnError)
+    fs.StringVar(&c.addrs, "addr", "127.0.0.1:6379", "redis地址, 多个地址用逗号分隔时使用集群客户端")
+    fs.StringVar(&c.password, "password", "", "redis密码")
+    fs.IntVar(&c.db, "db", 0, "redis库, 集群模式下无效")
+    fs.StringVar(&c.mode, "mode", "redis", "缓存数据库类型, redis 或 redis_hash")
+    fs.BoolVar(&c.md5, "md5", true, "是否对query的路径做md5, 与 WithMd5QueryParams 相同")
+    fs.StringVar(&c.codec, "codec", codec.DefaultCodecType.String(), "编解码器名, 如 msgpack, json, jsoniterator, byte")
+    fs.BoolVar(&c.generation, "generation", false, "redis模式下按代数删除空间, 与 redis.WithDelSpaceMode(redis.DelSpaceByGeneration) 相同")
+    fs.Int64Var(&c.scan_count, "scan-count", redis.DefaultScanCount, "扫描时每批的数量")
+    fs.BoolVar(&c.yes, "yes", false, "确认执行 flush-space")
+    fs.Usage = func() {
+        fmt.Fprint(fs.Output(), usage)
+        fs.PrintDefaults()
+    }
+    _ = fs.Parse(os.Args[1:])
+
+    args := fs.Args()
+    if len(args) < 2 {
+        fs.Usage()
+        os.Exit(2)
+    }
+    if args[1] == "" {
+        fmt.Fprintln(os.Stderr, "空间名不能为空")
+        fs.Usage()
+        os.Exit(2)
+    }
+
+    if err := run(&c, args[0], query.NewQuery(args[1], args[2:]...)); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+}
+
+func run(c *config, cmd string, q *query.Query) error {
+    ctype, ok := parseCodec(c.codec)
+    if !ok {
+        return fmt.Errorf("未知的编解码器<%s>", c.codec)
+    }
+
+    client := rredis.NewUniversalClient(&rredis.UniversalOptions{
+        Addrs:    strings.Split(c.addrs, ","),
+        Password: c.password,
+        DB:       c.db,
+    })
+    defer client.Close()
+
+    var cdb cachedb.ICacheDB
+    switch c.mode {
+    case "redis":
+        mode := redis.DelSpaceByScan
+        if c.generation {
+            mode = redis.DelSpaceByGeneration
+        }
+        cdb = redis.Wrap(client,
+            redis.WithCodecType(ctype),
+            redis.WithMd5QueryParams(c.md5),
+            redis.WithDelSpaceMode(mode),
+            redis.WithScanCount(c.scan_count),
+        )
+    case "redis_hash":
+        cdb = redis_hash.Wrap(client,
+            redis_hash.WithCodecType(ctype),
+            redis_hash.WithMd5QueryParams(c.md5),
+        )
+    default:
+        return fmt.Errorf("未知的缓存数据库类型<%s>", c.mode)
+    }
+
+    switch cmd {
+    case "get":
+        return get(cdb, ctype, q)
+    case "del":
+        return cdb.Del(q)
+    case "ttl":
+        ttl, err := cdb.(cachedb.ITTLCacheDB).TTL(q)
+        if err != nil {
+            return err
+        }
+        return printJSON(map[string]interface{}{"key": cacheKey(cdb, q), "ttl": formatTTL(ttl)})
+    case "scan-space":
+        return scanSpace(c, client, q.Space())
+    case "flush-space":
+        if !c.yes {
+            return fmt.Errorf("删除空间<%s>的所有数据需要 -yes", q.Space())
+        }
+        return cdb.DelSpaceData(q.Space())
+    }
+    return fmt.Errorf("未知的命令<%s>", cmd)
+}
+
+func get(cdb cachedb.ICacheDB, ctype codec.CodecType, q *query.Query) error {
+    out := map[string]interface{}{"key": cacheKey(cdb, q)}
+
+    var a interface{} = new(interface{})
+    if ctype == codec.Byte {
+        a = new([]byte)
+    }
+    v, err := cdb.Get(q, a)
+    switch err {
+    case nil:
+        out["value"] = jsonable(v)
+    case errs.NoEntry:
+        out["no_entry"] = true
+    case errs.ErrNoEntry:
+        return fmt.Errorf("key<%s>不存在", out["key"])
+    default:
+        return err
+    }
+
+    if ttl, err := cdb.(cachedb.ITTLCacheDB).TTL(q); err == nil {
+        out["ttl"] = formatTTL(ttl)
+    }
+    return printJSON(out)
+}
+
+// 列出空间的所有key, redis_hash模式下列出哈希表的所有字段, 按代数删除空间时只列出当前代数的key
+func scanSpace(c *config, client rredis.UniversalClient, space string) error {
+    if c.mode == "redis_hash" {
+        iter := client.HScan(space, 0, "", c.scan_count).Iterator()
+        for i := 0; iter.Next(); i++ {
+            if i%2 == 0 { // 字段和值交替出现
+                fmt.Println(iter.Val())
+            }
+        }
+        return iter.Err()
+    }
+
+    // 按代数删除空间时key为 空间名:代数:路径
+    prefix := space
+    if c.generation {
+        gen, err := client.Get(redis.GenerationKeyPrefix + space).Result()
+        if err == rredis.Nil {
+            gen = "0"
+        } else if err != nil {
+            return err
+        }
+        prefix = space + ":" + gen
+    }
+
+    scan := func(client rredis.UniversalClient) error {
+        iter := client.Scan(0, redis.SpaceKeyPattern(prefix), c.scan_count).Iterator()
+        for iter.Next() {
+            if redis.IsSpaceKey(prefix, iter.Val()) {
+                fmt.Println(iter.Val())
+            }
+        }
+        return iter.Err()
+    }
+    if cluster, ok := client.(*rredis.ClusterClient); ok {
+        return cluster.ForEachMaster(func(c *rredis.Client) error {
+            return scan(c)
+        })
+    }
+    return scan(client)
+}
+
+func cacheKey(cdb cachedb.ICacheDB, q *query.Query) string {
+    key, err := cdb.(cachedb.IKeyCacheDB).CacheKey(q)
+    if err != nil {
+        return fmt.Sprintf("<%v>", err)
+    }
+    return key
+}
+
+func parseCodec(name string) (codec.CodecType, bool) {
+    for t := range codec.Codecs {
+        if t.String() == strings.ToLower(name) {
+            return t, true
+        }
+    }
+    return 0, false
+}
+
+func formatTTL(ttl time.Duration) string {
+    if ttl < 0 {
+        return "-1"
+    }
+    return ttl.String()
+}
+
+// 将解码后的数据转为可以编码为json的数据, msgpack解码的map的key可能不是字符串
+func jsonable(v interface{}) interface{} {
+    switch v := v.(type) {
+    case *interface{}:
+        return jsonable(*v)
+    case *[]byte:
+        return string(*v)
+    case []byte:
+        return string(v)
+    case map[interface{}]interface{}:
+        out := make(map[string]interface{}, len(v))
+        for k, e := range v {
+            out[fmt.Sprint(k)] = jsonable(e)
+        }
+        return out
+    case map[string]interface{}:
+        for k, e := range v {
+            v[k] = jsonable(e)
+        }
+        return v
+    case []interface{}:
+        for i, e := range v {
+            v[i] = jsonable(e)
+        }
+        return v
+    }
+    return v
+}
+
+func printJSON(v interface{}) error {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(v)
+}
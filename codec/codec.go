@@ -42,6 +42,23 @@ const (
     Thrift
 )
 
+var codecNames = map[CodecType]string{
+    Byte:         "byte",
+    JSON:         "json",
+    JsonIterator: "jsoniterator",
+    MsgPack:      "msgpack",
+    ProtoBuffer:  "protobuf",
+    Thrift:       "thrift",
+}
+
+// 编解码器类型名, 自定义编解码器类型会返回 codec(类型值)
+func (t CodecType) String() string {
+    if name, ok := codecNames[t]; ok {
+        return name
+    }
+    return fmt.Sprintf("codec(%d)", byte(t))
+}
+
 // 编解码器
 type ICodec interface {
     // 编码
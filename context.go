@@ -0,0 +1,119 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  上下文
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "time"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+// 如果ctx为nil则返回 context.Background()
+func makeContext(ctx context.Context) context.Context {
+    if ctx == nil {
+        return context.Background()
+    }
+    return ctx
+}
+
+// 从缓存数据库获取值, 优先使用带上下文的方法
+func cdbGet(ctx context.Context, c cachedb.ICacheDB, query *Query, a interface{}) (interface{}, error) {
+    if cc, ok := c.(cachedb.IContextCacheDB); ok {
+        return cc.GetContext(ctx, query, a)
+    }
+    return c.Get(query, a)
+}
+
+// 设置值到缓存数据库, 优先使用带上下文的方法
+func cdbSet(ctx context.Context, c cachedb.ICacheDB, query *Query, v interface{}, ex time.Duration) error {
+    if cc, ok := c.(cachedb.IContextCacheDB); ok {
+        return cc.SetContext(ctx, query, v, ex)
+    }
+    return c.Set(query, v, ex)
+}
+
+// 从缓存数据库删除值, 优先使用带上下文的方法
+func cdbDel(ctx context.Context, c cachedb.ICacheDB, query *Query) error {
+    if cc, ok := c.(cachedb.IContextCacheDB); ok {
+        return cc.DelContext(ctx, query)
+    }
+    return c.Del(query)
+}
+
+// 从缓存数据库批量获取值, 优先使用带上下文的方法
+func cdbMGet(ctx context.Context, c cachedb.IBatchCacheDB, queries []*Query, as []interface{}) ([]interface{}, []error) {
+    if cc, ok := c.(cachedb.IContextBatchCacheDB); ok {
+        return cc.MGetContext(ctx, queries, as)
+    }
+    return c.MGet(queries, as)
+}
+
+// 从缓存数据库获取剩余有效时间, 优先使用带上下文的方法
+func cdbTTL(ctx context.Context, c cachedb.ITTLCacheDB, query *Query) (time.Duration, error) {
+    if cc, ok := c.(cachedb.IContextTTLCacheDB); ok {
+        return cc.TTLContext(ctx, query)
+    }
+    return c.TTL(query)
+}
+
+// 删除缓存数据库的空间数据, 优先使用带上下文的方法
+func cdbDelSpaceData(ctx context.Context, c cachedb.ICacheDB, space string) error {
+    if cc, ok := c.(cachedb.IContextSpaceCacheDB); ok {
+        return cc.DelSpaceDataContext(ctx, space)
+    }
+    return c.DelSpaceData(space)
+}
+
+// 删除标签关联的所有数据, 优先使用带上下文的方法
+func cdbDelTag(ctx context.Context, c cachedb.ITagCacheDB, tag string) error {
+    if cc, ok := c.(cachedb.IContextTagCacheDB); ok {
+        return cc.DelTagContext(ctx, tag)
+    }
+    return c.DelTag(tag)
+}
+
+// 调用加载器, 优先使用带上下文的方法
+func loaderLoad(ctx context.Context, loader ILoader, query *Query) (interface{}, error) {
+    if cloader, ok := loader.(IContextLoader); ok {
+        return cloader.LoadContext(ctx, query)
+    }
+    return loader.Load(query)
+}
+
+// 调用批量加载器, 加载器支持上下文时会传入ctx
+func loaderLoadMulti(ctx context.Context, loader IBatchLoader, queries []*Query) ([]interface{}, []error, error) {
+    if cloader, ok := loader.(IContextBatchLoader); ok {
+        return cloader.LoadMultiContext(ctx, queries)
+    }
+    return loader.LoadMulti(queries)
+}
+
+// 同一个key的并发请求共享的加载上下文, 保留ctx中的值, 但是不会因为ctx被取消而中断
+func (m *BECache) sharedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+    ctx = detachContext(ctx)
+    if m.shared_load_timeout > 0 {
+        return context.WithTimeout(ctx, m.shared_load_timeout)
+    }
+    return ctx, func() {}
+}
+
+// 一个保留了父级的值但是不会被取消的上下文, 用于后台任务
+type detachedContext struct {
+    parent context.Context
+}
+
+func detachContext(ctx context.Context) context.Context {
+    return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (c detachedContext) Value(key interface{}) interface{}     { return c.parent.Value(key) }
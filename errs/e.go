@@ -19,3 +19,21 @@ var ErrNoEntry = errors.New("条目不存在")
 
 // 由缓存保存的ErrNoEntry错误
 var NoEntry = errors.New("空条目")
+
+// 加载失败时返回了过期的数据
+var ErrStaleData = errors.New("返回了过期数据")
+
+// 缓存数据库不支持标签
+var ErrTagNotSupported = errors.New("缓存数据库不支持标签")
+
+// 加载器并发已满且等待队列已满
+var ErrLoaderOverloaded = errors.New("加载器过载")
+
+// 加载器超过了设置的超时时间
+var ErrLoadTimeout = errors.New("db加载超时")
+
+// BECache已关闭
+var ErrClosed = errors.New("BECache已关闭")
+
+// 枚举key的函数不存在
+var ErrKeysFnNotExists = errors.New("枚举key的函数不存在或为空")
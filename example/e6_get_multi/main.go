@@ -0,0 +1,48 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package main
+
+import (
+    "fmt"
+
+    "github.com/zlyuancn/zbec"
+)
+
+func main() {
+    // 创建缓存服务
+    bec := zbec.NewOfGoCache(0)
+
+    // 注册支持批量加载的加载器, 缓存中不存在的条目会通过一次调用加载
+    bec.RegisterLoader(zbec.NewNameLoader("test", nil).SetMultiLoader(func(queries []*zbec.Query) ([]interface{}, []error, error) {
+        outs := make([]interface{}, len(queries))
+        es := make([]error, len(queries))
+        for i, q := range queries {
+            if q.Params()[0] == "" {
+                es[i] = zbec.ErrNoEntry
+                continue
+            }
+            outs[i] = "hello " + q.Params()[0]
+        }
+        return outs, es, nil
+    }))
+
+    queries := []*zbec.Query{
+        zbec.NewQuery("test", "a"),
+        zbec.NewQuery("test", ""),
+        zbec.NewQuery("test", "b"),
+    }
+
+    // 结果会按 queries 的顺序写入a, 返回的错误列表与 queries 一一对应
+    var a []string
+    es, _ := bec.GetMulti(nil, queries, &a)
+
+    for i := range queries {
+        fmt.Println(a[i], es[i])
+    }
+}
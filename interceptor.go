@@ -0,0 +1,145 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  拦截器
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "errors"
+    "sync"
+)
+
+// 拦截阶段
+type Stage string
+
+const (
+    // 获取数据, 结果为用户传入的接收变量, 批量获取时为每个条目的数据
+    StageGet Stage = "get"
+    // 调用加载器, 结果为加载器返回的数据
+    StageLoad Stage = "load"
+    // 写入缓存, 结果为写入的数据
+    StageSet Stage = "set"
+    // 删除数据, 结果为nil
+    StageDel Stage = "del"
+    // 删除空间数据, query 只包含空间名, 结果为nil
+    StageDelSpace Stage = "del_space"
+)
+
+// 被拦截的处理函数
+type Handler func(ctx context.Context, query *Query) (interface{}, error)
+
+// 拦截器, 调用 next 才会继续执行后续的拦截器和实际的处理函数, 可以修改传给 next 的 ctx 和 query
+// StageLoad 阶段返回的结果会作为加载结果, 其它阶段只使用返回的错误, 返回的结果会被忽略
+//
+// 先注册的拦截器在外层
+// 批量获取和批量加载时每个条目单独经过拦截器, 所有调用了 next 的条目会合并为一次批量处理, 批量处理使用调用者的ctx, 每个条目只能调用一次 next
+type Interceptor func(ctx context.Context, stage Stage, query *Query, next Handler) (interface{}, error)
+
+// 批量处理时重复调用 next
+var errMultiNextCalled = errors.New("批量处理时每个条目只能调用一次next")
+
+// 通过拦截器链执行处理函数
+func (m *BECache) intercept(ctx context.Context, stage Stage, query *Query, handler Handler) (interface{}, error) {
+    if len(m.interceptors) == 0 {
+        return handler(ctx, query)
+    }
+
+    h := handler
+    for i := len(m.interceptors) - 1; i >= 0; i-- {
+        interceptor, next := m.interceptors[i], h
+        h = func(ctx context.Context, query *Query) (interface{}, error) {
+            return interceptor(ctx, stage, query, next)
+        }
+    }
+    return h(ctx, query)
+}
+
+// 批量处理函数, indexes 为调用了 next 的条目在原始列表中的索引, 返回的结果与 queries 一一对应
+type multiHandler func(ctx context.Context, indexes []int, queries []*Query) ([]interface{}, []error)
+
+// 批量处理中的一个条目
+type multiCall struct {
+    mx     sync.Mutex
+    query  *Query
+    nexted bool          // 是否调用了 next
+    ready  chan struct{} // 调用了 next 或者拦截器已返回
+    result chan multiCallResult
+    out    interface{}
+    err    error
+}
+
+// 批量处理中一个条目的结果
+type multiCallResult struct {
+    out interface{}
+    err error
+}
+
+// 每个条目单独通过拦截器链, 调用了 next 的条目合并后调用一次处理函数, 返回拦截器链的结果
+func (m *BECache) interceptMulti(ctx context.Context, stage Stage, queries []*Query, handler multiHandler) ([]interface{}, []error) {
+    if len(m.interceptors) == 0 {
+        indexes := make([]int, len(queries))
+        for i := range indexes {
+            indexes[i] = i
+        }
+        return handler(ctx, indexes, queries)
+    }
+
+    calls := make([]*multiCall, len(queries))
+    var wg sync.WaitGroup
+    for i, q := range queries {
+        c := &multiCall{ready: make(chan struct{}), result: make(chan multiCallResult, 1)}
+        calls[i] = c
+        wg.Add(1)
+        go func(q *Query) {
+            defer wg.Done()
+            var once sync.Once
+            c.out, c.err = m.intercept(ctx, stage, q, func(_ context.Context, query *Query) (interface{}, error) {
+                c.mx.Lock()
+                if c.nexted {
+                    c.mx.Unlock()
+                    return nil, errMultiNextCalled
+                }
+                c.nexted, c.query = true, query
+                c.mx.Unlock()
+                once.Do(func() { close(c.ready) })
+
+                r := <-c.result
+                return r.out, r.err
+            })
+            once.Do(func() { close(c.ready) })
+        }(q)
+    }
+
+    var indexes []int
+    var qs []*Query
+    for i, c := range calls {
+        <-c.ready
+        c.mx.Lock()
+        if c.nexted {
+            indexes, qs = append(indexes, i), append(qs, c.query)
+        } else {
+            c.nexted = true // 拦截器返回后不能再调用 next
+        }
+        c.mx.Unlock()
+    }
+
+    if len(indexes) > 0 {
+        houts, hes := handler(ctx, indexes, qs)
+        for j, i := range indexes {
+            calls[i].result <- multiCallResult{houts[j], hes[j]}
+        }
+    }
+    wg.Wait()
+
+    outs := make([]interface{}, len(queries))
+    es := make([]error, len(queries))
+    for i, c := range calls {
+        outs[i], es[i] = c.out, c.err
+    }
+    return outs, es
+}
@@ -0,0 +1,76 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  本地缓存失效通知
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+// 发布失效事件, 失败时只记录日志
+func (m *BECache) publish(ctx context.Context, event *cachedb.InvalidationEvent) {
+    if m.bus == nil {
+        return
+    }
+    if err := m.bus.Publish(detachContext(ctx), event); err != nil {
+        m.log.Warn(zerrors.WithMessagef(err, "发布失效事件失败<%s:%s>", event.Op, event.Space))
+    }
+}
+
+// 订阅失效总线, 在所有选项应用完成后调用, 同一个总线只会订阅一次
+func (m *BECache) subscribe() {
+    if m.bus == nil || m.bus == m.subscribed {
+        return
+    }
+    m.subscribed = m.bus
+    if err := m.bus.Subscribe(m.onInvalidation); err != nil {
+        m.log.Error(zerrors.WithMessage(err, "订阅失效事件失败"))
+    }
+}
+
+// 收到失效事件时删除本地缓存
+func (m *BECache) onInvalidation(event *cachedb.InvalidationEvent) {
+    switch event.Op {
+    case cachedb.InvalidateDel, cachedb.InvalidateSet:
+        if event.Space != "" {
+            _ = m.local_cdb.Del(NewQuery(event.Space, event.Params...))
+        }
+    case cachedb.InvalidateDelSpace:
+        if event.Space != "" {
+            _ = m.local_cdb.DelSpaceData(event.Space)
+        }
+    case cachedb.InvalidateTag:
+        if tc, ok := m.local_cdb.(cachedb.ITagCacheDB); ok {
+            _ = tc.DelTag(event.Tag)
+        }
+    case cachedb.InvalidateAll:
+        if cc, ok := m.local_cdb.(cachedb.IClearCacheDB); ok {
+            if err := cc.Clear(); err != nil {
+                m.log.Warn(zerrors.WithMessage(err, "清除本地缓存失败"))
+            }
+            return
+        }
+
+        // 本地缓存没有清除全部数据的方法, 只能删除已注册加载器的空间
+        m.log.Warn(zerrors.NewSimplef("本地缓存 %T 没有实现 cachedb.IClearCacheDB, 只清除了已注册加载器的空间, 其它空间可能保留过期的数据", m.local_cdb))
+        m.mx.RLock()
+        spaces := make([]string, 0, len(m.loaders))
+        for space := range m.loaders {
+            spaces = append(spaces, space)
+        }
+        m.mx.RUnlock()
+
+        for _, space := range spaces {
+            _ = m.local_cdb.DelSpaceData(space)
+        }
+    }
+}
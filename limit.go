@@ -0,0 +1,171 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  加载器并发限制
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+)
+
+// 加载器过载时的处理方式
+type OverloadPolicy int
+
+const (
+    // 直接返回 ErrLoaderOverloaded 错误
+    OverloadFailFast OverloadPolicy = iota
+    // 有保留的过期数据时返回过期数据和 ErrStaleData 错误, 否则返回 ErrLoaderOverloaded 错误
+    OverloadServeStale
+)
+
+// 限制并发的加载器
+type ILimitLoader interface {
+    ILoader
+    // 返回同一个空间同时调用加载器的最大数量, 等待队列的长度和队列满时的处理方式, max 为0表示不限制
+    ConcurrencyLimit() (max, queue int, policy OverloadPolicy)
+}
+
+// 空间的并发限制器
+type limiter struct {
+    sem     chan struct{}
+    queue   int32
+    waiting int32
+    policy  OverloadPolicy
+}
+
+func newLimiter(max, queue int, policy OverloadPolicy) *limiter {
+    if queue < 0 {
+        queue = 0
+    }
+    return &limiter{
+        sem:    make(chan struct{}, max),
+        queue:  int32(queue),
+        policy: policy,
+    }
+}
+
+// 获取执行权, 没有空闲位置时进入等待队列, 队列满时返回 ErrLoaderOverloaded
+func (l *limiter) acquire(ctx context.Context) error {
+    select {
+    case l.sem <- struct{}{}:
+        return nil
+    default:
+    }
+
+    if atomic.AddInt32(&l.waiting, 1) > l.queue {
+        atomic.AddInt32(&l.waiting, -1)
+        return ErrLoaderOverloaded
+    }
+    defer atomic.AddInt32(&l.waiting, -1)
+
+    select {
+    case l.sem <- struct{}{}:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (l *limiter) release() {
+    <-l.sem
+}
+
+// 获取空间的并发限制器, 加载器没有限制并发时返回nil
+// 限制器在空间第一次加载时根据加载器的设置创建, 之后修改加载器的设置不会生效
+func (m *BECache) getLimiter(space string, loader ILoader) *limiter {
+    lloader, ok := loader.(ILimitLoader)
+    if !ok {
+        return nil
+    }
+
+    if l, ok := m.limiters.Load(space); ok {
+        return l.(*limiter)
+    }
+    max, queue, policy := lloader.ConcurrencyLimit()
+    if max <= 0 {
+        return nil
+    }
+    l, _ := m.limiters.LoadOrStore(space, newLimiter(max, queue, policy))
+    return l.(*limiter)
+}
+
+// 在并发限制内调用fn, fn 中实际调用加载器时需要通过 holdLimitSlot 占用位置
+// 超时后放弃等待的加载器在返回前会一直占用位置, 所以不会因为加载器忽略ctx而超过并发限制
+func (m *BECache) limit(ctx context.Context, space string, loader ILoader, fn func(ctx context.Context) error) error {
+    l := m.getLimiter(space, loader)
+    if l == nil {
+        return fn(ctx)
+    }
+
+    if err := l.acquire(ctx); err != nil {
+        if err == ErrLoaderOverloaded {
+            m.stats.incr(space, loaderRejected)
+        }
+        return err
+    }
+    slot := &limitSlot{l: l}
+    defer slot.close()
+    return fn(context.WithValue(ctx, limitSlotKey{}, slot))
+}
+
+type limitSlotKey struct{}
+
+// limit 获取的位置, 在 limit 返回并且占用位置的加载器返回后释放
+type limitSlot struct {
+    l      *limiter
+    mx     sync.Mutex
+    busy   bool // 是否有加载器正在占用位置
+    closed bool // limit 是否已经返回
+}
+
+// 调用加载器前占用 limit 获取的位置, 返回释放位置的函数
+// 之前超时的加载器仍然占用着位置时, 比如超时后重试, 需要重新获取一个位置
+func holdLimitSlot(ctx context.Context) (func(), error) {
+    slot, ok := ctx.Value(limitSlotKey{}).(*limitSlot)
+    if !ok {
+        return func() {}, nil
+    }
+
+    slot.mx.Lock()
+    if !slot.busy {
+        slot.busy = true
+        slot.mx.Unlock()
+        return func() {
+            slot.mx.Lock()
+            slot.busy = false
+            release := slot.closed
+            slot.mx.Unlock()
+            if release {
+                slot.l.release()
+            }
+        }, nil
+    }
+    slot.mx.Unlock()
+
+    if err := slot.l.acquire(ctx); err != nil {
+        return nil, err
+    }
+    return slot.l.release, nil
+}
+
+func (s *limitSlot) close() {
+    s.mx.Lock()
+    s.closed = true
+    release := !s.busy
+    s.mx.Unlock()
+    if release {
+        s.l.release()
+    }
+}
+
+// 加载器过载时是否可以返回过期数据
+func (m *BECache) overloadServeStale(space string) bool {
+    l, ok := m.limiters.Load(space)
+    return !ok || l.(*limiter).policy == OverloadServeStale
+}
@@ -9,40 +9,156 @@
 package zbec
 
 import (
+    "context"
+    "math"
     "time"
+
+    "github.com/afex/hystrix-go/hystrix"
+
+    "github.com/zlyuancn/zbec/retry"
 )
 
+// 断路器默认的最大并发数, 加载器的并发应该通过 Loader.SetConcurrencyLimit 限制
+var DefaultCircuitMaxConcurrent = 5000
+
 // 加载器
 type ILoader interface {
     // 加载器名
     Name() string
     // 缓存数据不存在时会调用此方法获取数据, 获取的数据会自动缓存
-    // 多个进程相同的加载请求同一时刻只有一个进程会调用这个方法, 其他进程会等待结果
+    // 同一进程相同的加载请求同一时刻只有一个goroutine会调用这个方法, 其他goroutine会等待结果
+    // 使用支持跨进程的单飞模块(如 redis.NewSingleFlight)时, 多个进程同一时刻只有一个进程会调用这个方法
     Load(query *Query) (interface{}, error)
     // 数据缓存时会调用这个方法获取缓存时间
     Expire() (ex time.Duration)
 }
 
+// 支持上下文的加载器, BECache会优先调用 LoadContext
+type IContextLoader interface {
+    ILoader
+    // 与 Load 相同, ctx 携带了调用者的截止时间和值
+    LoadContext(ctx context.Context, query *Query) (interface{}, error)
+}
+
+// 支持批量加载的加载器
+type IBatchLoader interface {
+    ILoader
+    // 批量加载数据, 返回的结果和错误与 queries 一一对应, 不存在的条目对应的错误应该为 ErrNoEntry
+    // 如果返回的 err 不为nil, 表示整批加载失败
+    LoadMulti(queries []*Query) ([]interface{}, []error, error)
+}
+
+// 支持上下文的批量加载器, BECache会优先调用 LoadMultiContext
+type IContextBatchLoader interface {
+    IBatchLoader
+    // 与 LoadMulti 相同, ctx 携带了调用者的截止时间和值
+    LoadMultiContext(ctx context.Context, queries []*Query) ([]interface{}, []error, error)
+}
+
+// 支持软过期的加载器
+//
+// 数据在缓存中超过软过期时间后被视为陈旧数据, 获取数据时会立即返回陈旧数据并在后台刷新
+type ISoftExpireLoader interface {
+    ILoader
+    // 返回软过期时间和计算数据写入时长的过期时间基准, soft 为0表示不启用软过期
+    // 缓存数据库中数据的剩余有效时间小于 base-soft 时被视为陈旧数据, base 为-1时使用BECache默认过期时间
+    SoftExpire() (soft, base time.Duration)
+}
+
+// 加载失败时可以返回过期数据的加载器
+type IServeStaleLoader interface {
+    ILoader
+    // 数据过期后的保留时间, 在这段时间内db加载失败会返回过期数据, 返回0表示不启用, 返回-1表示使用BECache的设置
+    ServeStaleOnError() time.Duration
+}
+
+// 可以为加载的数据添加标签的加载器
+type ITagLoader interface {
+    ILoader
+    // 返回数据的标签, 数据写入缓存时会同时添加这些标签, 不存在的条目 a 为nil
+    Tags(query *Query, a interface{}) []string
+}
+
+// 限制加载时间的加载器
+type ITimeoutLoader interface {
+    ILoader
+    // 每次调用加载器的超时时间, 0表示不限制
+    LoadTimeout() time.Duration
+}
+
+// 加载失败时重试的加载器
+type IRetryLoader interface {
+    ILoader
+    // 重试策略, nil表示不重试
+    RetryPolicy() *retry.Policy
+}
+
+// 可以枚举所有key的加载器, 用于重建布隆过滤器和预热
+type IKeysLoader interface {
+    ILoader
+    // 遍历db中所有数据的query, fn 返回错误时应该停止遍历并返回这个错误
+    RangeKeys(ctx context.Context, fn func(query *Query) error) error
+}
+
 // db加载函数, 如果是不存在的条目, 应该返回 zbec.ErrNoEntry
 type LoaderFn func(query *Query) (interface{}, error)
 
-var _ ILoader = (*Loader)(nil)
+// 支持上下文的db加载函数, 如果是不存在的条目, 应该返回 zbec.ErrNoEntry
+type ContextLoaderFn func(ctx context.Context, query *Query) (interface{}, error)
+
+// db批量加载函数, 返回的结果和错误与 queries 一一对应, 不存在的条目对应的错误应该为 zbec.ErrNoEntry
+type MultiLoaderFn func(queries []*Query) ([]interface{}, []error, error)
+
+// 支持上下文的db批量加载函数, 规则与 MultiLoaderFn 相同
+type MultiContextLoaderFn func(ctx context.Context, queries []*Query) ([]interface{}, []error, error)
+
+// 标签函数, 返回数据的标签, 不存在的条目 a 为nil
+type TagsFn func(query *Query, a interface{}) []string
+
+// 枚举key的函数, 遍历db中所有数据的query, fn 返回错误时应该停止遍历并返回这个错误
+type KeysFn func(ctx context.Context, fn func(query *Query) error) error
+
+var _ IContextLoader = (*Loader)(nil)
+var _ IBatchLoader = (*Loader)(nil)
+var _ IContextBatchLoader = (*Loader)(nil)
+var _ ISoftExpireLoader = (*Loader)(nil)
+var _ IServeStaleLoader = (*Loader)(nil)
+var _ ITagLoader = (*Loader)(nil)
+var _ IKeysLoader = (*Loader)(nil)
+var _ ILimitLoader = (*Loader)(nil)
+var _ ICircuitLoader = (*Loader)(nil)
+var _ ITimeoutLoader = (*Loader)(nil)
+var _ IRetryLoader = (*Loader)(nil)
 
 // 加载配置
 type Loader struct {
-    name      string        // 加载器名
-    loader    LoaderFn      // 从db加载函数
-    ex, endex time.Duration // 有效时间
+    name             string               // 加载器名
+    loader           LoaderFn             // 从db加载函数
+    ctx_loader       ContextLoaderFn      // 支持上下文的从db加载函数
+    multi_loader     MultiLoaderFn        // 从db批量加载函数
+    ctx_multi_loader MultiContextLoaderFn // 支持上下文的从db批量加载函数
+    ex, endex        time.Duration        // 有效时间
+    soft_ex          time.Duration        // 软过期时间
+    stale_ex         time.Duration        // 过期数据保留时间
+    tags             TagsFn               // 标签函数
+    keys             KeysFn               // 枚举key的函数
+    max_loads        int                  // 同时调用加载器的最大数量
+    load_queue       int                  // 等待队列长度
+    overload         OverloadPolicy       // 过载时的处理方式
+    circuit          string               // 断路器名
+    fallback         FallbackFn           // 断路器打开时的降级函数
+    timeout          time.Duration        // 每次加载的超时时间
+    retry            *retry.Policy        // 重试策略
 }
 
 // 创建一个加载器
 func NewLoader(loader LoaderFn) *Loader {
-    return &Loader{loader: loader, ex: -1}
+    return &Loader{loader: loader, ex: -1, stale_ex: -1}
 }
 
 // 创建一个加载器并指定名称
 func NewNameLoader(name string, loader LoaderFn) *Loader {
-    return &Loader{name: name, loader: loader, ex: -1}
+    return &Loader{name: name, loader: loader, ex: -1, stale_ex: -1}
 }
 
 func (m *Loader) Name() string {
@@ -51,15 +167,98 @@ func (m *Loader) Name() string {
 
 func (m *Loader) Load(query *Query) (interface{}, error) {
     if m.loader == nil {
+        if m.ctx_loader != nil {
+            return m.ctx_loader(context.Background(), query)
+        }
         return nil, ErrLoaderFnNotExists
     }
     return m.loader(query)
 }
 
+// 带上下文加载, 如果没有设置支持上下文的db加载函数, 会调用 Load
+func (m *Loader) LoadContext(ctx context.Context, query *Query) (interface{}, error) {
+    if m.ctx_loader != nil {
+        return m.ctx_loader(ctx, query)
+    }
+    return m.Load(query)
+}
+
+// 批量加载, 如果没有设置db批量加载函数, 会逐个调用 Load
+func (m *Loader) LoadMulti(queries []*Query) ([]interface{}, []error, error) {
+    return m.LoadMultiContext(context.Background(), queries)
+}
+
+// 带上下文批量加载, 优先使用支持上下文的db批量加载函数, 如果没有设置db批量加载函数, 会逐个调用 LoadContext
+func (m *Loader) LoadMultiContext(ctx context.Context, queries []*Query) ([]interface{}, []error, error) {
+    if m.ctx_multi_loader != nil {
+        return m.ctx_multi_loader(ctx, queries)
+    }
+    if m.multi_loader != nil {
+        return m.multi_loader(queries)
+    }
+    if m.loader == nil && m.ctx_loader == nil {
+        return nil, nil, ErrLoaderFnNotExists
+    }
+
+    outs := make([]interface{}, len(queries))
+    es := make([]error, len(queries))
+    for i, q := range queries {
+        outs[i], es[i] = m.LoadContext(ctx, q)
+    }
+    return outs, es, nil
+}
+
 func (m *Loader) Expire() time.Duration {
     return makeExpire(m.ex, m.endex)
 }
 
+func (m *Loader) SoftExpire() (soft, base time.Duration) {
+    return m.soft_ex, m.ex
+}
+
+func (m *Loader) ServeStaleOnError() time.Duration {
+    return m.stale_ex
+}
+
+// 枚举key, 如果没有设置枚举key的函数, 会返回 ErrKeysFnNotExists
+func (m *Loader) RangeKeys(ctx context.Context, fn func(query *Query) error) error {
+    if m.keys == nil {
+        return ErrKeysFnNotExists
+    }
+    return m.keys(ctx, fn)
+}
+
+func (m *Loader) ConcurrencyLimit() (max, queue int, policy OverloadPolicy) {
+    return m.max_loads, m.load_queue, m.overload
+}
+
+func (m *Loader) LoadTimeout() time.Duration {
+    return m.timeout
+}
+
+func (m *Loader) RetryPolicy() *retry.Policy {
+    return m.retry
+}
+
+func (m *Loader) CircuitName() string {
+    return m.circuit
+}
+
+// 断路器打开时调用降级函数, 如果没有设置降级函数会返回 err
+func (m *Loader) CircuitFallback(ctx context.Context, query *Query, err error) (interface{}, error) {
+    if m.fallback == nil {
+        return nil, err
+    }
+    return m.fallback(ctx, query, err)
+}
+
+func (m *Loader) Tags(query *Query, a interface{}) []string {
+    if m.tags == nil {
+        return nil
+    }
+    return m.tags(query, a)
+}
+
 // 设置加载器名称
 func (m *Loader) SetName(name string) *Loader {
     m.name = name
@@ -72,6 +271,24 @@ func (m *Loader) SetLoader(fn LoaderFn) *Loader {
     return m
 }
 
+// 设置支持上下文的db加载函数
+func (m *Loader) SetContextLoader(fn ContextLoaderFn) *Loader {
+    m.ctx_loader = fn
+    return m
+}
+
+// 设置db批量加载函数
+func (m *Loader) SetMultiLoader(fn MultiLoaderFn) *Loader {
+    m.multi_loader = fn
+    return m
+}
+
+// 设置支持上下文的db批量加载函数
+func (m *Loader) SetMultiContextLoader(fn MultiContextLoaderFn) *Loader {
+    m.ctx_multi_loader = fn
+    return m
+}
+
 // 设置过期时间
 // 如果 ex 为-1(默认), 则使用BECache默认过期时间
 // 如果 ex, endex 都为0, 则永不过期
@@ -81,3 +298,77 @@ func (m *Loader) SetExpire(ex, endex time.Duration) *Loader {
     m.ex, m.endex = ex, endex
     return m
 }
+
+// 设置软过期时间, 数据写入缓存超过 soft 时间后, 获取数据时会立即返回旧数据并在后台刷新, 每个key同时只会有一个刷新任务
+// 软过期时间应该小于过期时间, 如果过期时间为随机区间, 则以 ex 为基准计算数据写入时长
+// 软过期需要缓存数据库实现 cachedb.ITTLCacheDB, 永不过期的数据不会触发软过期
+func (m *Loader) SetSoftExpire(soft time.Duration) *Loader {
+    m.soft_ex = soft
+    return m
+}
+
+// 设置过期数据保留时间, 数据过期后会在缓存中保留 ex 时间, 在这段时间内db加载失败时会返回过期数据和 ErrStaleData 错误
+// 如果 ex 为-1(默认), 则使用BECache的设置, 如果 ex 为0, 则不保留过期数据
+// 需要缓存数据库实现 cachedb.ITTLCacheDB
+func (m *Loader) SetServeStaleOnError(ex time.Duration) *Loader {
+    m.stale_ex = ex
+    return m
+}
+
+// 设置标签函数, 数据写入缓存时会添加标签函数返回的标签, 可以通过 BECache.InvalidateTag 删除标签关联的所有数据
+// 需要缓存数据库实现 cachedb.ITagCacheDB
+func (m *Loader) SetTags(fn TagsFn) *Loader {
+    m.tags = fn
+    return m
+}
+
+// 设置枚举key的函数, 用于重建布隆过滤器和预热
+func (m *Loader) SetKeys(fn KeysFn) *Loader {
+    m.keys = fn
+    return m
+}
+
+// 设置并发限制, 同一个空间同时最多有 max 个调用加载器, 超过时最多 queue 个请求排队等待, 队列满时按 policy 处理
+// 批量加载每批算一次调用, 限制在单飞模块之后生效, 所以只会限制不同key的并发
+// 必须在空间第一次加载前设置, max 为0表示不限制
+func (m *Loader) SetConcurrencyLimit(max, queue int, policy OverloadPolicy) *Loader {
+    m.max_loads, m.load_queue, m.overload = max, queue, policy
+    return m
+}
+
+// 设置断路器, 10秒内的调用次数达到20次并且错误百分比超过 errPercent 时打开断路器, 打开后经过 sleep 时间会放行一次调用尝试恢复
+// 断路器打开时不会调用加载器, 会调用降级函数, 没有设置降级函数时返回 ErrCircuitOpen, 如果设置了过期数据保留时间会返回过期数据
+// 相同名称的加载器共享同一个断路器, name 为空表示不使用断路器, ErrNoEntry 不会被视为错误
+func (m *Loader) SetCircuitBreaker(name string, errPercent int, sleep time.Duration) *Loader {
+    m.circuit = name
+    if name != "" {
+        hystrix.ConfigureCommand(name, hystrix.CommandConfig{
+            Timeout:               math.MaxInt32, // 超时由ctx控制
+            MaxConcurrentRequests: DefaultCircuitMaxConcurrent,
+            SleepWindow:           int(sleep / time.Millisecond),
+            ErrorPercentThreshold: errPercent,
+        })
+    }
+    return m
+}
+
+// 设置断路器打开时的降级函数, 可以返回默认值, 返回的数据不会写入缓存
+func (m *Loader) SetCircuitFallback(fn FallbackFn) *Loader {
+    m.fallback = fn
+    return m
+}
+
+// 设置每次调用加载器的超时时间, 超时后返回 ErrLoadTimeout, 加载器会收到在超时后取消的ctx
+// 不支持上下文的加载器超时后会在后台继续执行直到结束, 0表示不限制
+func (m *Loader) SetTimeout(timeout time.Duration) *Loader {
+    m.timeout = timeout
+    return m
+}
+
+// 设置加载失败时的重试策略, 每次重试都会重新计算超时时间, ErrNoEntry 不会重试
+//
+//  loader.SetRetry(retry.New(3, time.Millisecond*50, time.Second))
+func (m *Loader) SetRetry(policy *retry.Policy) *Loader {
+    m.retry = policy
+    return m
+}
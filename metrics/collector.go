@@ -0,0 +1,123 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  缓存数据库调用统计
+-------------------------------------------------
+*/
+
+package metrics
+
+import (
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// 缓存数据库调用收集器, 将 Observe 方法设置为缓存数据库的观察者即可收集数据
+//
+//  c := metrics.NewCacheDBCollector("redis")
+//  cdb := redis.Wrap(client, redis.WithObserver(c.Observe))
+type CacheDBCollector struct {
+    name    string
+    buckets []time.Duration
+
+    opStats map[string]*opCounter
+    mx      sync.RWMutex
+}
+
+// 创建一个缓存数据库调用收集器, 不设置 buckets 时使用 DefaultCacheDBBuckets
+func NewCacheDBCollector(name string, buckets ...time.Duration) *CacheDBCollector {
+    if len(buckets) == 0 {
+        buckets = DefaultCacheDBBuckets
+    }
+    return &CacheDBCollector{
+        name:    name,
+        buckets: buckets,
+        opStats: make(map[string]*opCounter),
+    }
+}
+
+// 收集器名
+func (c *CacheDBCollector) Name() string {
+    return c.name
+}
+
+// 记录一次调用
+func (c *CacheDBCollector) Observe(op string, latency time.Duration, err error) {
+    oc := c.op(op)
+    atomic.AddUint64(&oc.count, 1)
+    atomic.AddInt64(&oc.sum, int64(latency))
+    if err != nil {
+        atomic.AddUint64(&oc.errors, 1)
+    }
+    for i, b := range c.buckets {
+        if latency <= b {
+            atomic.AddUint64(&oc.buckets[i], 1)
+            break
+        }
+    }
+}
+
+func (c *CacheDBCollector) op(op string) *opCounter {
+    c.mx.RLock()
+    oc, ok := c.opStats[op]
+    c.mx.RUnlock()
+
+    if ok {
+        return oc
+    }
+
+    c.mx.Lock()
+    if oc, ok = c.opStats[op]; !ok {
+        oc = &opCounter{name: op, buckets: make([]uint64, len(c.buckets))}
+        c.opStats[op] = oc
+    }
+    c.mx.Unlock()
+    return oc
+}
+
+// 获取所有操作的计数器, 按操作名排序
+func (c *CacheDBCollector) ops() []*opCounter {
+    c.mx.RLock()
+    out := make([]*opCounter, 0, len(c.opStats))
+    for _, oc := range c.opStats {
+        out = append(out, oc)
+    }
+    c.mx.RUnlock()
+
+    sort.Slice(out, func(i, j int) bool {
+        return out[i].name < out[j].name
+    })
+    return out
+}
+
+// 操作计数器
+type opCounter struct {
+    count   uint64
+    errors  uint64
+    sum     int64
+    name    string
+    buckets []uint64
+}
+
+type opSnapshot struct {
+    count   uint64
+    errors  uint64
+    sum     time.Duration
+    buckets []uint64
+}
+
+func (oc *opCounter) snapshot() opSnapshot {
+    buckets := make([]uint64, len(oc.buckets))
+    for i := range oc.buckets {
+        buckets[i] = atomic.LoadUint64(&oc.buckets[i])
+    }
+    return opSnapshot{
+        count:   atomic.LoadUint64(&oc.count),
+        errors:  atomic.LoadUint64(&oc.errors),
+        sum:     time.Duration(atomic.LoadInt64(&oc.sum)),
+        buckets: buckets,
+    }
+}
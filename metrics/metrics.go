@@ -0,0 +1,253 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  prometheus 文本格式的监控数据导出
+-------------------------------------------------
+*/
+
+package metrics
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/zlyuancn/zbec"
+)
+
+// 默认指标名前缀
+const DefaultNamespace = "zbec"
+
+// 缓存数据库调用耗时统计区间的上限
+var DefaultCacheDBBuckets = []time.Duration{
+    time.Microsecond * 100,
+    time.Microsecond * 500,
+    time.Millisecond,
+    time.Microsecond * 2500,
+    time.Millisecond * 5,
+    time.Millisecond * 10,
+    time.Millisecond * 25,
+    time.Millisecond * 50,
+    time.Millisecond * 100,
+    time.Millisecond * 250,
+    time.Millisecond * 500,
+    time.Second,
+}
+
+var _ http.Handler = (*Exporter)(nil)
+var _ io.WriterTo = (*Exporter)(nil)
+
+// 监控数据导出器, 实现了 http.Handler, 以 prometheus 文本格式输出已注册的 BECache 和缓存数据库的统计数据
+type Exporter struct {
+    namespace string
+
+    becs map[string]*zbec.BECache
+    cdbs map[string]*CacheDBCollector
+    mx   sync.RWMutex
+}
+
+func NewExporter(opts ...Option) *Exporter {
+    m := &Exporter{
+        namespace: DefaultNamespace,
+        becs:      make(map[string]*zbec.BECache),
+        cdbs:      make(map[string]*CacheDBCollector),
+    }
+    for _, o := range opts {
+        o(m)
+    }
+    return m
+}
+
+// 注册BECache, name 会作为指标的 bec 标签, 同名的会被替换掉
+func (m *Exporter) RegisterBECache(name string, bec *zbec.BECache) {
+    m.mx.Lock()
+    m.becs[name] = bec
+    m.mx.Unlock()
+}
+
+// 注册缓存数据库收集器, 收集器名会作为指标的 cachedb 标签, 同名的会被替换掉
+func (m *Exporter) RegisterCacheDB(c *CacheDBCollector) {
+    m.mx.Lock()
+    m.cdbs[c.name] = c
+    m.mx.Unlock()
+}
+
+func (m *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    _, _ = m.WriteTo(w)
+}
+
+// 将所有指标以 prometheus 文本格式写入 w
+func (m *Exporter) WriteTo(w io.Writer) (int64, error) {
+    var buf bytes.Buffer
+    m.writeBECaches(&buf)
+    m.writeCacheDBs(&buf)
+    return buf.WriteTo(w)
+}
+
+// BECache的计数器指标
+var becCounters = []struct {
+    name string
+    help string
+    get  func(s *zbec.SpaceStats) uint64
+}{
+    {"local_hits_total", "本地缓存命中次数", func(s *zbec.SpaceStats) uint64 { return s.LocalHits }},
+    {"cache_hits_total", "缓存数据库命中次数", func(s *zbec.SpaceStats) uint64 { return s.CacheHits }},
+    {"no_entry_hits_total", "命中空条目的次数", func(s *zbec.SpaceStats) uint64 { return s.NoEntryHits }},
+    {"loader_calls_total", "加载器调用次数", func(s *zbec.SpaceStats) uint64 { return s.LoaderCalls }},
+    {"loader_errors_total", "加载器返回错误的次数", func(s *zbec.SpaceStats) uint64 { return s.LoaderErrors }},
+    {"singleflight_shared_waits_total", "通过单飞模块等待其它请求结果的次数", func(s *zbec.SpaceStats) uint64 { return s.SharedWaits }},
+    {"cache_set_errors_total", "写入缓存数据库失败的次数", func(s *zbec.SpaceStats) uint64 { return s.CacheSetErrors }},
+    {"loader_rejected_total", "加载器过载被拒绝的次数", func(s *zbec.SpaceStats) uint64 { return s.LoaderRejected }},
+}
+
+type becSpaceStats struct {
+    bec   string
+    space string
+    stats zbec.SpaceStats
+}
+
+func (m *Exporter) writeBECaches(buf *bytes.Buffer) {
+    m.mx.RLock()
+    names := make([]string, 0, len(m.becs))
+    for name := range m.becs {
+        names = append(names, name)
+    }
+    becs := make([]*zbec.BECache, 0, len(names))
+    sort.Strings(names)
+    for _, name := range names {
+        becs = append(becs, m.becs[name])
+    }
+    m.mx.RUnlock()
+
+    var all []becSpaceStats
+    for i, bec := range becs {
+        stats := bec.Stats()
+        spaces := make([]string, 0, len(stats))
+        for space := range stats {
+            spaces = append(spaces, space)
+        }
+        sort.Strings(spaces)
+        for _, space := range spaces {
+            all = append(all, becSpaceStats{bec: names[i], space: space, stats: stats[space]})
+        }
+    }
+    if len(all) == 0 {
+        return
+    }
+
+    for _, c := range becCounters {
+        name := m.namespace + "_" + c.name
+        writeHeader(buf, name, c.help, "counter")
+        for i := range all {
+            writeSample(buf, name, labels("bec", all[i].bec, "space", all[i].space), strconv.FormatUint(c.get(&all[i].stats), 10))
+        }
+    }
+
+    name := m.namespace + "_loader_latency_seconds"
+    writeHeader(buf, name, "加载器耗时", "histogram")
+    for i := range all {
+        s := &all[i].stats
+        writeHistogram(buf, name, labels("bec", all[i].bec, "space", all[i].space), zbec.LatencyBuckets, s.LoaderLatencyBuckets, s.LoaderCalls, s.LoaderLatency)
+    }
+}
+
+func (m *Exporter) writeCacheDBs(buf *bytes.Buffer) {
+    m.mx.RLock()
+    names := make([]string, 0, len(m.cdbs))
+    for name := range m.cdbs {
+        names = append(names, name)
+    }
+    cdbs := make([]*CacheDBCollector, 0, len(names))
+    sort.Strings(names)
+    for _, name := range names {
+        cdbs = append(cdbs, m.cdbs[name])
+    }
+    m.mx.RUnlock()
+
+    type opStats struct {
+        cdb  *CacheDBCollector
+        op   string
+        snap opSnapshot
+    }
+    var all []opStats
+    for _, c := range cdbs {
+        for _, op := range c.ops() {
+            all = append(all, opStats{cdb: c, op: op.name, snap: op.snapshot()})
+        }
+    }
+    if len(all) == 0 {
+        return
+    }
+
+    name := m.namespace + "_cachedb_errors_total"
+    writeHeader(buf, name, "缓存数据库调用返回错误的次数", "counter")
+    for _, s := range all {
+        writeSample(buf, name, labels("cachedb", s.cdb.name, "op", s.op), strconv.FormatUint(s.snap.errors, 10))
+    }
+
+    name = m.namespace + "_cachedb_latency_seconds"
+    writeHeader(buf, name, "缓存数据库调用耗时", "histogram")
+    for _, s := range all {
+        writeHistogram(buf, name, labels("cachedb", s.cdb.name, "op", s.op), s.cdb.buckets, s.snap.buckets, s.snap.count, s.snap.sum)
+    }
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, typ string) {
+    fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+    fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+}
+
+func writeSample(buf *bytes.Buffer, name, labels, value string) {
+    buf.WriteString(name)
+    if labels != "" {
+        buf.WriteByte('{')
+        buf.WriteString(labels)
+        buf.WriteByte('}')
+    }
+    buf.WriteByte(' ')
+    buf.WriteString(value)
+    buf.WriteByte('\n')
+}
+
+// 写入直方图, counts 为每个区间的次数(不累计)
+func writeHistogram(buf *bytes.Buffer, name, lbs string, buckets []time.Duration, counts []uint64, count uint64, sum time.Duration) {
+    var cumulative uint64
+    for i, b := range buckets {
+        if i < len(counts) {
+            cumulative += counts[i]
+        }
+        writeSample(buf, name+"_bucket", lbs+","+labels("le", formatSeconds(b)), strconv.FormatUint(cumulative, 10))
+    }
+    writeSample(buf, name+"_bucket", lbs+","+labels("le", "+Inf"), strconv.FormatUint(count, 10))
+    writeSample(buf, name+"_sum", lbs, formatSeconds(sum))
+    writeSample(buf, name+"_count", lbs, strconv.FormatUint(count, 10))
+}
+
+func formatSeconds(d time.Duration) string {
+    return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 生成标签文本, kvs 为交替的标签名和标签值
+func labels(kvs ...string) string {
+    var bs strings.Builder
+    for i := 0; i+1 < len(kvs); i += 2 {
+        if i > 0 {
+            bs.WriteByte(',')
+        }
+        bs.WriteString(kvs[i])
+        bs.WriteString(`="`)
+        bs.WriteString(labelValueReplacer.Replace(kvs[i+1]))
+        bs.WriteByte('"')
+    }
+    return bs.String()
+}
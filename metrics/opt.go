@@ -0,0 +1,21 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :
+-------------------------------------------------
+*/
+
+package metrics
+
+type Option func(m *Exporter)
+
+// 设置指标名前缀, 默认为 zbec
+func WithNamespace(namespace string) Option {
+    return func(m *Exporter) {
+        if namespace == "" {
+            namespace = DefaultNamespace
+        }
+        m.namespace = namespace
+    }
+}
@@ -0,0 +1,347 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  批量获取
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "reflect"
+    "time"
+
+    "github.com/vmihailenco/msgpack"
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+// 批量获取数据, a 必须是一个切片指针, 结果会按 queries 的顺序写入 a
+// 返回的错误列表与 queries 一一对应, 单个条目获取失败不会影响其它条目, 失败条目在 a 中为零值
+// 本地缓存和缓存数据库都没有的条目会按空间分组交给加载器, 加载器实现了 IBatchLoader 时每个空间只会调用一次 LoadMulti
+// 批量获取不经过单飞模块
+func (m *BECache) GetMulti(ctx context.Context, queries []*Query, a interface{}) ([]error, error) {
+    ctx = makeContext(ctx)
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+
+    ctx, span := m.startSpan(ctx, SpanGetMulti, nil)
+    span.SetAttribute(AttrQueryCount, len(queries))
+    es, err := m.getMulti(ctx, queries, a)
+    endSpan(span, err)
+    return es, err
+}
+
+func (m *BECache) getMulti(ctx context.Context, queries []*Query, a interface{}) ([]error, error) {
+    av := reflect.ValueOf(a)
+    if av.Kind() != reflect.Ptr || av.Elem().Kind() != reflect.Slice {
+        return nil, zerrors.NewSimplef("接收结果的变量必须是切片指针, 但收到了 %T", a)
+    }
+    sv := av.Elem()
+
+    // 每个条目单独经过拦截器, 拦截器返回的结果会被忽略
+    outs := make([]interface{}, len(queries))
+    _, es := m.interceptMulti(ctx, StageGet, queries, func(ctx context.Context, indexes []int, qs []*Query) ([]interface{}, []error) {
+        houts, hes := m.multiQuery(ctx, qs, sv.Type().Elem())
+        for j, i := range indexes {
+            outs[i] = houts[j]
+        }
+        return houts, hes
+    })
+
+    sv.Set(reflect.MakeSlice(sv.Type(), len(queries), len(queries)))
+    for i, out := range outs {
+        // 返回过期数据时仍然需要将数据写入a
+        if es[i] != nil && zerrors.Cause(es[i]) != ErrStaleData {
+            if es[i] == NoEntry {
+                es[i] = ErrNoEntry
+            }
+            es[i] = zerrors.WithMessagef(es[i], "加载失败<%s>", queries[i].FullPath())
+            continue
+        }
+        if out == nil {
+            es[i] = errors.New("未对nil数据做处理")
+            continue
+        }
+        if err := m.setMultiResult(out, sv.Index(i)); err != nil {
+            es[i] = err
+            continue
+        }
+        if es[i] != nil {
+            es[i] = zerrors.WithMessagef(es[i], "加载失败<%s>", queries[i].FullPath())
+        }
+    }
+    return es, nil
+}
+
+// 将结果写入切片的元素
+func (m *BECache) setMultiResult(out interface{}, elem reflect.Value) error {
+    if m.deepcopy_result {
+        var buf bytes.Buffer
+        if err := msgpack.NewEncoder(&buf).Encode(out); err != nil {
+            return err
+        }
+        return msgpack.NewDecoder(&buf).Decode(elem.Addr().Interface())
+    }
+
+    elem.Set(reflect.Indirect(reflect.ValueOf(out)))
+    return nil
+}
+
+func (m *BECache) multiQuery(ctx context.Context, queries []*Query, elemType reflect.Type) ([]interface{}, []error) {
+    outs := make([]interface{}, len(queries))
+    es := make([]error, len(queries))
+    as := make([]interface{}, len(queries))
+    for i := range as {
+        as[i] = reflect.New(elemType).Interface()
+    }
+
+    // 本地缓存
+    var misses []int
+    for i, q := range queries {
+        out, err := cdbGet(ctx, m.local_cdb, q, as[i])
+        if err == nil {
+            m.stats.incr(q.Space(), localHits)
+            outs[i] = out
+            continue
+        }
+        if err == NoEntry {
+            m.stats.incr(q.Space(), noEntryHits)
+            es[i] = NoEntry
+            continue
+        }
+        misses = append(misses, i)
+    }
+    if len(misses) == 0 {
+        return outs, es
+    }
+
+    // 缓存数据库
+    expireds := make([]interface{}, len(queries))
+    misses = m.multiCacheGet(ctx, queries, as, misses, outs, es, expireds)
+    if len(misses) == 0 {
+        return outs, es
+    }
+
+    // 按空间分组从db加载
+    spaces := make(map[string][]int)
+    var order []string
+    for _, i := range misses {
+        space := queries[i].Space()
+        if _, ok := spaces[space]; !ok {
+            order = append(order, space)
+        }
+        spaces[space] = append(spaces[space], i)
+    }
+    for _, space := range order {
+        m.multiLoadDB(ctx, queries, spaces[space], m.getLoader(space), outs, es)
+    }
+
+    // db加载失败时返回过期数据, 加载器过载时根据加载器的设置决定是否返回过期数据
+    for _, i := range misses {
+        lerr := es[i]
+        if expireds[i] == nil || lerr == nil || lerr == ErrNoEntry {
+            continue
+        }
+        if zerrors.Cause(lerr) == ErrLoaderOverloaded && !m.overloadServeStale(queries[i].Space()) {
+            continue
+        }
+        m.log.Warn(zerrors.WithMessagef(lerr, "返回过期数据<%s>", queries[i].FullPath()))
+        outs[i], es[i] = expireds[i], zerrors.WithMessage(ErrStaleData, lerr.Error())
+    }
+    return outs, es
+}
+
+// 从缓存数据库批量获取, 返回仍需要从db加载的条目索引, 缓存数据库的有效错误会保留在 es 中
+// 已过期的条目同样需要从db加载, 过期数据会保存在 expireds 中作为db加载失败时的备用数据
+func (m *BECache) multiCacheGet(ctx context.Context, queries []*Query, as []interface{}, indexes []int, outs []interface{}, es []error, expireds []interface{}) []int {
+    qs := make([]*Query, len(indexes))
+    qas := make([]interface{}, len(indexes))
+    for j, i := range indexes {
+        qs[j], qas[j] = queries[i], as[i]
+    }
+
+    var couts []interface{}
+    var ces []error
+    if bcdb, ok := m.cdb.(cachedb.IBatchCacheDB); ok {
+        couts, ces = cdbMGet(ctx, bcdb, qs, qas)
+    } else {
+        couts = make([]interface{}, len(qs))
+        ces = make([]error, len(qs))
+        for j, q := range qs {
+            couts[j], ces[j] = cdbGet(ctx, m.cdb, q, qas[j])
+        }
+    }
+
+    var misses []int
+    for j, i := range indexes {
+        switch err := ces[j]; err {
+        case nil:
+            loader := m.getLoader(queries[i].Space())
+            expired, stale := m.checkTTL(ctx, queries[i], loader)
+            if expired {
+                expireds[i] = couts[j]
+                misses = append(misses, i)
+                continue
+            }
+
+            m.stats.incr(queries[i].Space(), cacheHits)
+            _ = cdbSet(ctx, m.local_cdb, queries[i], couts[j], m.local_cdb_ex)
+            outs[i] = couts[j]
+            if stale && loader != nil {
+                m.refresh(ctx, queries[i], loader)
+            }
+        case NoEntry:
+            m.stats.incr(queries[i].Space(), noEntryHits)
+            _ = cdbSet(ctx, m.local_cdb, queries[i], NoEntry, m.local_cdb_ex)
+            es[i] = NoEntry
+        case ErrNoEntry:
+            misses = append(misses, i)
+        default:
+            es[i] = zerrors.WithMessage(err, "缓存加载失败")
+            misses = append(misses, i)
+        }
+    }
+    return misses
+}
+
+// 从db批量加载同一个空间的条目
+func (m *BECache) multiLoadDB(ctx context.Context, queries []*Query, indexes []int, loader ILoader, outs []interface{}, es []error) {
+    if loader == nil {
+        for _, i := range indexes {
+            es[i] = zerrors.NewSimplef("<%s>加载器为nil", queries[i].Space())
+        }
+        return
+    }
+
+    if err := m.beginLoad(); err != nil {
+        for _, i := range indexes {
+            es[i] = mergeLoadErr(es[i], err)
+        }
+        return
+    }
+    defer m.endLoad()
+
+    // 布隆过滤器判断一定不存在的条目不需要加载
+    passed := indexes[:0:0]
+    for _, i := range indexes {
+        if m.bloomReject(ctx, queries[i]) {
+            out, lerr := m.saveLoadResult(ctx, queries[i], loader, nil, ErrNoEntry)
+            outs[i], es[i] = out, mergeLoadErr(es[i], lerr)
+            continue
+        }
+        passed = append(passed, i)
+    }
+    if indexes = passed; len(indexes) == 0 {
+        return
+    }
+
+    bloader, ok := loader.(IBatchLoader)
+    if !ok {
+        for _, i := range indexes {
+            out, lerr := m.loadDB(ctx, queries[i], loader, false)
+            outs[i], es[i] = out, mergeLoadErr(es[i], lerr)
+        }
+        return
+    }
+
+    qs := make([]*Query, len(indexes))
+    for j, i := range indexes {
+        qs[j] = queries[i]
+    }
+
+    // 每个条目单独经过拦截器, 通过拦截器的条目合并为一次批量加载
+    var berr error
+    sctx, span := m.startSpan(ctx, SpanLoad, qs[0])
+    span.SetAttribute(AttrQueryCount, len(qs))
+    louts, les := m.interceptMulti(sctx, StageLoad, qs, func(ctx context.Context, _ []int, qs []*Query) ([]interface{}, []error) {
+        louts, les, err := m.multiLoad(ctx, qs, loader, bloader)
+        if err != nil {
+            berr, les = err, make([]error, len(qs))
+            for j := range les {
+                les[j] = err
+            }
+        }
+        return louts, les
+    })
+    endSpan(span, berr)
+
+    for j, i := range indexes {
+        // 断路器打开时每个条目单独调用降级函数, 降级函数返回的数据不写入缓存
+        if fallback, ok := circuitFallback(loader, les[j]); ok {
+            out, ferr := fallback(ctx, queries[i], les[j])
+            if ferr != nil && ferr != ErrNoEntry {
+                ferr = zerrors.WithMessage(ferr, "db加载失败")
+            }
+            outs[i], es[i] = out, mergeLoadErr(es[i], ferr)
+            continue
+        }
+
+        out, lerr := m.saveLoadResult(ctx, queries[i], loader, louts[j], les[j])
+        outs[i], es[i] = out, mergeLoadErr(es[i], lerr)
+    }
+}
+
+// 调用批量加载器, 返回的结果与 queries 一一对应, 整批加载失败时返回错误
+func (m *BECache) multiLoad(ctx context.Context, queries []*Query, loader ILoader, bloader IBatchLoader) ([]interface{}, []error, error) {
+    if err := ctx.Err(); err != nil {
+        return make([]interface{}, len(queries)), nil, err
+    }
+
+    var louts []interface{}
+    var les []error
+    err := m.limit(ctx, queries[0].Space(), loader, func(ctx context.Context) error {
+        out, err := m.circuit(ctx, loader, func(ctx context.Context) (interface{}, error) {
+            return callLoader(ctx, loader, func(ctx context.Context) (interface{}, error) {
+                release, err := holdLimitSlot(ctx)
+                if err != nil {
+                    return nil, err
+                }
+                defer release()
+
+                start := time.Now()
+                outs, es, err := loaderLoadMulti(ctx, bloader, queries)
+                m.stats.load(queries[0].Space(), time.Since(start), err)
+                return &multiResult{outs, es}, err
+            })
+        })
+        if err == nil {
+            r := out.(*multiResult)
+            louts, les = r.outs, r.es
+        }
+        return err
+    })
+    if err == nil && (len(louts) != len(queries) || (les != nil && len(les) != len(queries))) {
+        err = zerrors.NewSimplef("db批量加载结果数量非预期, 需要%d个", len(queries))
+    }
+    if err != nil {
+        return make([]interface{}, len(queries)), nil, err
+    }
+    if les == nil {
+        les = make([]error, len(queries))
+    }
+    return louts, les, nil
+}
+
+// 批量加载的结果
+type multiResult struct {
+    outs []interface{}
+    es   []error
+}
+
+// 合并缓存错误和db加载错误
+func mergeLoadErr(gerr, lerr error) error {
+    if lerr == nil {
+        return nil
+    }
+    if gerr != nil {
+        return zerrors.WithMessage(gerr, lerr.Error())
+    }
+    return lerr
+}
@@ -13,6 +13,8 @@ import (
 
     "github.com/zlyuancn/zlog2"
 
+    "github.com/zlyuancn/zbec/bloom"
+    "github.com/zlyuancn/zbec/cachedb"
     "github.com/zlyuancn/zbec/cachedb/go_cache"
     "github.com/zlyuancn/zbec/cachedb/nocache"
 )
@@ -29,7 +31,7 @@ func WithLogger(log ILoger) Option {
     }
 }
 
-// 设置本地缓存
+// 设置本地缓存, 开启时使用不限制内存的 go_cache, 可以通过 WithLocalCacheDB 使用其它本地缓存如 lru.New()
 func WithLocalCache(local_cache bool, ex ...time.Duration) Option {
     return func(m *BECache) {
         if local_cache {
@@ -45,6 +47,21 @@ func WithLocalCache(local_cache bool, ex ...time.Duration) Option {
     }
 }
 
+// 设置本地缓存数据库, 比如限制内存的 lru.New(lru.WithMaxEntries(n)), 为nil时关闭本地缓存
+func WithLocalCacheDB(cdb cachedb.ICacheDB, ex ...time.Duration) Option {
+    return func(m *BECache) {
+        if cdb == nil {
+            cdb = nocache.New()
+        }
+        m.local_cdb = cdb
+
+        m.local_cdb_ex = DefaultLocalCacheExpire
+        if len(ex) > 0 && ex[0] > 0 {
+            m.local_cdb_ex = ex[0]
+        }
+    }
+}
+
 // 设置缓存空条目
 func WithCacheNoEntry(cache_no_entry bool, ex ...time.Duration) Option {
     return func(m *BECache) {
@@ -77,6 +94,60 @@ func WithDefaultExpire(ex time.Duration, endex ...time.Duration) Option {
     }
 }
 
+// 设置过期数据保留时间, 数据过期后会在缓存中保留 ex 时间, 在这段时间内db加载失败时会返回过期数据和 ErrStaleData 错误
+// 加载器可以通过 Loader.SetServeStaleOnError 单独设置, 需要缓存数据库实现 cachedb.ITTLCacheDB
+func WithServeStaleOnError(ex time.Duration) Option {
+    return func(m *BECache) {
+        if ex < 0 {
+            ex = 0
+        }
+        m.stale_ex = ex
+    }
+}
+
+// 设置是否开启统计, 默认开启
+func WithStats(b bool) Option {
+    return func(m *BECache) {
+        m.stats.disable = !b
+    }
+}
+
+// 添加拦截器, 先添加的拦截器在外层
+func WithInterceptor(interceptors ...Interceptor) Option {
+    return func(m *BECache) {
+        m.interceptors = append(m.interceptors, interceptors...)
+    }
+}
+
+// 设置链路追踪器, 默认不追踪
+func WithTracer(tracer ITracer) Option {
+    return func(m *BECache) {
+        m.tracer = tracer
+    }
+}
+
+// 设置本地缓存失效总线, 删除或设置数据时会通知其它进程删除本地缓存, 收到其它进程的通知时删除自己的本地缓存
+// 所有选项应用完成后才会订阅, 所以订阅失败的日志会使用 WithLogger 设置的日志组件
+func WithInvalidationBus(bus cachedb.IInvalidationBus) Option {
+    return func(m *BECache) {
+        m.bus = bus
+    }
+}
+
+// 为空间设置布隆过滤器, 调用加载器前会先检查布隆过滤器, 一定不存在的key直接视为空条目
+// 过滤器需要通过 BECache.AddBloomKeys 或 BECache.RebuildBloomFilter 添加key
+func WithBloomFilter(space string, filter bloom.IFilter) Option {
+    return func(m *BECache) {
+        m.mx.Lock()
+        if filter == nil {
+            delete(m.filters, space)
+        } else {
+            m.filters[space] = filter
+        }
+        m.mx.Unlock()
+    }
+}
+
 // 设置单飞模块
 func WithSingleFlight(sf ISingleFlight) Option {
     return func(m *BECache) {
@@ -86,3 +157,11 @@ func WithSingleFlight(sf ISingleFlight) Option {
         m.sf = sf
     }
 }
+
+// 设置同一个key的并发请求共享的加载超时时间, 默认为 DefaultSharedLoadTimeout, 小于等于0表示不限制
+// 共享的加载和缓存写入不受单个请求的ctx影响, 只受这个超时时间限制
+func WithSharedLoadTimeout(timeout time.Duration) Option {
+    return func(m *BECache) {
+        m.shared_load_timeout = timeout
+    }
+}
@@ -0,0 +1,78 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  加载器超时和重试
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "time"
+
+    "github.com/zlyuancn/zbec/retry"
+)
+
+// 按加载器的超时和重试设置调用fn, ErrNoEntry 不会重试
+func callLoader(ctx context.Context, loader ILoader, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+    var timeout time.Duration
+    if tloader, ok := loader.(ITimeoutLoader); ok {
+        timeout = tloader.LoadTimeout()
+    }
+    var policy *retry.Policy
+    if rloader, ok := loader.(IRetryLoader); ok {
+        policy = rloader.RetryPolicy()
+    }
+    if policy == nil {
+        return callTimeout(ctx, timeout, fn)
+    }
+
+    var out interface{}
+    err := policy.Do(ctx, func(ctx context.Context) error {
+        var err error
+        out, err = callTimeout(ctx, timeout, fn)
+        if err == ErrNoEntry {
+            return retry.Stop(err)
+        }
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+// 在超时时间内调用fn, 超时后返回 ErrLoadTimeout, fn会在后台继续执行直到结束
+func callTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+    if timeout <= 0 {
+        return fn(ctx)
+    }
+
+    tctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    type result struct {
+        out interface{}
+        err error
+    }
+    done := make(chan result, 1)
+    go func() {
+        out, err := fn(tctx)
+        done <- result{out, err}
+    }()
+
+    select {
+    case r := <-done:
+        if r.err != nil && ctx.Err() == nil && tctx.Err() == context.DeadlineExceeded {
+            return nil, ErrLoadTimeout
+        }
+        return r.out, r.err
+    case <-tctx.Done():
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        return nil, ErrLoadTimeout
+    }
+}
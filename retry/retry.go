@@ -0,0 +1,122 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  指数退避重试
+-------------------------------------------------
+*/
+
+package retry
+
+import (
+    "context"
+    "math/rand"
+    "time"
+)
+
+// 重试策略, 可以被多个goroutine同时使用
+type Policy struct {
+    attempts  int
+    base      time.Duration
+    max       time.Duration
+    retryable func(err error) bool
+}
+
+// 创建重试策略, attempts 为最大尝试次数(包括第一次)
+// 第n次重试前等待 [0, base*2^(n-1)] 之间的随机时间, max 大于0时等待时间不会超过 max
+func New(attempts int, base, max time.Duration) *Policy {
+    if attempts < 1 {
+        attempts = 1
+    }
+    return &Policy{attempts: attempts, base: base, max: max}
+}
+
+// 设置判断错误是否可以重试的函数, 默认除了上下文被取消或超时的错误都可以重试
+func (p *Policy) SetRetryable(fn func(err error) bool) *Policy {
+    p.retryable = fn
+    return p
+}
+
+// 最大尝试次数
+func (p *Policy) Attempts() int {
+    return p.attempts
+}
+
+// 第n次重试前的等待时间, 从1开始
+func (p *Policy) Backoff(n int) time.Duration {
+    if p.base <= 0 || n < 1 {
+        return 0
+    }
+
+    d := p.base
+    for i := 1; i < n && (p.max <= 0 || d < p.max); i++ {
+        if d > d<<1 { // 溢出
+            break
+        }
+        d <<= 1
+    }
+    if p.max > 0 && d > p.max {
+        d = p.max
+    }
+    return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// 判断错误是否可以重试
+func (p *Policy) Retryable(err error) bool {
+    if err == nil {
+        return false
+    }
+    if _, ok := err.(*stopError); ok {
+        return false
+    }
+    if p.retryable != nil {
+        return p.retryable(err)
+    }
+    return err != context.Canceled && err != context.DeadlineExceeded
+}
+
+// 调用fn, fn返回可以重试的错误时等待一段时间后重试, 返回最后一次调用的错误
+// fn 返回 Stop 包装的错误时不会重试, 返回的错误为被包装的错误
+func (p *Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+    for n := 1; ; n++ {
+        err := fn(ctx)
+        if n >= p.attempts || !p.Retryable(err) {
+            return unwrapStop(err)
+        }
+
+        if d := p.Backoff(n); d > 0 {
+            t := time.NewTimer(d)
+            select {
+            case <-ctx.Done():
+                t.Stop()
+                return err
+            case <-t.C:
+            }
+        } else if ctx.Err() != nil {
+            return err
+        }
+    }
+}
+
+type stopError struct {
+    err error
+}
+
+func (e *stopError) Error() string {
+    return e.err.Error()
+}
+
+// 包装一个不需要重试的错误
+func Stop(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &stopError{err: err}
+}
+
+func unwrapStop(err error) error {
+    if e, ok := err.(*stopError); ok {
+        return e.err
+    }
+    return err
+}
@@ -0,0 +1,66 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  关闭
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "io"
+
+    "github.com/zlyuancn/zerrors"
+)
+
+// 开始一次加载, 已关闭时返回 ErrClosed, 成功时必须调用 endLoad
+func (m *BECache) beginLoad() error {
+    m.close_mx.RLock()
+    defer m.close_mx.RUnlock()
+    if m.closed {
+        return ErrClosed
+    }
+    m.loads.Add(1)
+    return nil
+}
+
+func (m *BECache) endLoad() {
+    m.loads.Done()
+}
+
+// 关闭, 关闭后不再调用加载器, 缓存中没有的数据会返回 ErrClosed
+// 会等待正在进行的加载和后台刷新结束, 加载结果写入缓存后依次关闭失效总线丶本地缓存和缓存数据库中实现了 io.Closer 的部分
+// ctx 结束时停止等待并返回错误, 此时不会关闭缓存数据库, 可以再次调用 Shutdown 继续等待
+func (m *BECache) Shutdown(ctx context.Context) error {
+    ctx = makeContext(ctx)
+    m.close_mx.Lock()
+    m.closed = true
+    m.close_mx.Unlock()
+
+    done := make(chan struct{})
+    go func() {
+        m.loads.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-ctx.Done():
+        return zerrors.WithMessage(ctx.Err(), "等待加载结束失败")
+    }
+
+    var err error
+    m.close_once.Do(func() {
+        for _, c := range []interface{}{m.bus, m.local_cdb, m.cdb} {
+            closer, ok := c.(io.Closer)
+            if !ok {
+                continue
+            }
+            if e := closer.Close(); e != nil && err == nil {
+                err = zerrors.WithMessage(e, "关闭失败")
+            }
+        }
+    })
+    return err
+}
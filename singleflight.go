@@ -8,10 +8,25 @@
 
 package zbec
 
+import (
+    "context"
+)
+
 type ISingleFlight interface {
     Do(key string, fn func() (interface{}, error)) (interface{}, error)
 }
 
+// 支持跨进程控制加载的单飞模块
+//
+// BECache 获取数据时仍然通过 Do 在进程内合并请求, 缓存未命中需要调用加载器时才会通过 DoLoad 跨进程加锁,
+// DoLoad 会在 Do 的 fn 中被调用, 所以不能再使用 Do 的进程内合并
+type ILoadSingleFlight interface {
+    ISingleFlight
+    // 同一时刻只有一个调用者会执行 load, 其它调用者等待后通过 recheck 从缓存获取数据,
+    // recheck 返回的 ok 为 false 表示数据还没有写入缓存
+    DoLoad(ctx context.Context, key string, load func() (interface{}, error), recheck func() (out interface{}, ok bool, err error)) (interface{}, error)
+}
+
 type noSingalFlight struct{}
 
 // 一个关闭并发控制的ISingleFlight
@@ -0,0 +1,178 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  统计
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// 加载器耗时统计区间的上限
+var LatencyBuckets = []time.Duration{
+    time.Millisecond,
+    time.Millisecond * 5,
+    time.Millisecond * 10,
+    time.Millisecond * 25,
+    time.Millisecond * 50,
+    time.Millisecond * 100,
+    time.Millisecond * 250,
+    time.Millisecond * 500,
+    time.Second,
+    time.Millisecond * 2500,
+    time.Second * 5,
+    time.Second * 10,
+}
+
+// 空间的统计数据
+type SpaceStats struct {
+    LocalHits      uint64        // 本地缓存命中次数
+    CacheHits      uint64        // 缓存数据库命中次数
+    NoEntryHits    uint64        // 命中空条目的次数, 包括本地缓存和缓存数据库
+    LoaderCalls    uint64        // 加载器调用次数, 批量加载每批算一次
+    LoaderErrors   uint64        // 加载器返回错误的次数, 不包括 ErrNoEntry
+    LoaderLatency  time.Duration // 加载器累计耗时
+    SharedWaits    uint64        // 通过单飞模块等待其它请求结果的次数
+    CacheSetErrors uint64        // 写入缓存数据库失败的次数
+    LoaderRejected uint64        // 加载器过载被拒绝的次数
+
+    // 加载器耗时分布, 与 LatencyBuckets 一一对应, 每个值为耗时落在该区间内的次数(不累计), 超过最大区间的次数不在其中
+    LoaderLatencyBuckets []uint64
+}
+
+// 空间的统计计数器
+type spaceCounter struct {
+    localHits      uint64
+    cacheHits      uint64
+    noEntryHits    uint64
+    loaderCalls    uint64
+    loaderErrors   uint64
+    loaderLatency  int64
+    sharedWaits    uint64
+    cacheSetErrors uint64
+    loaderRejected uint64
+
+    latencyBuckets []uint64
+}
+
+func newSpaceCounter() *spaceCounter {
+    return &spaceCounter{latencyBuckets: make([]uint64, len(LatencyBuckets))}
+}
+
+func (c *spaceCounter) snapshot() SpaceStats {
+    buckets := make([]uint64, len(c.latencyBuckets))
+    for i := range c.latencyBuckets {
+        buckets[i] = atomic.LoadUint64(&c.latencyBuckets[i])
+    }
+    return SpaceStats{
+        LocalHits:      atomic.LoadUint64(&c.localHits),
+        CacheHits:      atomic.LoadUint64(&c.cacheHits),
+        NoEntryHits:    atomic.LoadUint64(&c.noEntryHits),
+        LoaderCalls:    atomic.LoadUint64(&c.loaderCalls),
+        LoaderErrors:   atomic.LoadUint64(&c.loaderErrors),
+        LoaderLatency:  time.Duration(atomic.LoadInt64(&c.loaderLatency)),
+        SharedWaits:    atomic.LoadUint64(&c.sharedWaits),
+        CacheSetErrors: atomic.LoadUint64(&c.cacheSetErrors),
+        LoaderRejected: atomic.LoadUint64(&c.loaderRejected),
+
+        LoaderLatencyBuckets: buckets,
+    }
+}
+
+// 统计模块
+type statsRecorder struct {
+    disable bool
+    spaces  map[string]*spaceCounter
+    mx      sync.RWMutex
+}
+
+func newStatsRecorder() *statsRecorder {
+    return &statsRecorder{
+        spaces: make(map[string]*spaceCounter),
+    }
+}
+
+// 获取空间的计数器, 不存在时会创建
+func (m *statsRecorder) space(space string) *spaceCounter {
+    m.mx.RLock()
+    c, ok := m.spaces[space]
+    m.mx.RUnlock()
+
+    if ok {
+        return c
+    }
+
+    m.mx.Lock()
+    if c, ok = m.spaces[space]; !ok {
+        c = newSpaceCounter()
+        m.spaces[space] = c
+    }
+    m.mx.Unlock()
+    return c
+}
+
+// 为空间的一个计数器加1
+func (m *statsRecorder) incr(space string, field func(c *spaceCounter) *uint64) {
+    if m.disable {
+        return
+    }
+    atomic.AddUint64(field(m.space(space)), 1)
+}
+
+// 记录一次加载器调用
+func (m *statsRecorder) load(space string, latency time.Duration, err error) {
+    if m.disable {
+        return
+    }
+    c := m.space(space)
+    atomic.AddUint64(&c.loaderCalls, 1)
+    atomic.AddInt64(&c.loaderLatency, int64(latency))
+    for i, b := range LatencyBuckets {
+        if latency <= b {
+            atomic.AddUint64(&c.latencyBuckets[i], 1)
+            break
+        }
+    }
+    if err != nil && err != ErrNoEntry {
+        atomic.AddUint64(&c.loaderErrors, 1)
+    }
+}
+
+func (m *statsRecorder) snapshot() map[string]SpaceStats {
+    m.mx.RLock()
+    out := make(map[string]SpaceStats, len(m.spaces))
+    for space, c := range m.spaces {
+        out[space] = c.snapshot()
+    }
+    m.mx.RUnlock()
+    return out
+}
+
+func (m *statsRecorder) reset() {
+    m.mx.Lock()
+    m.spaces = make(map[string]*spaceCounter)
+    m.mx.Unlock()
+}
+
+func localHits(c *spaceCounter) *uint64      { return &c.localHits }
+func cacheHits(c *spaceCounter) *uint64      { return &c.cacheHits }
+func noEntryHits(c *spaceCounter) *uint64    { return &c.noEntryHits }
+func sharedWaits(c *spaceCounter) *uint64    { return &c.sharedWaits }
+func cacheSetErrors(c *spaceCounter) *uint64 { return &c.cacheSetErrors }
+func loaderRejected(c *spaceCounter) *uint64 { return &c.loaderRejected }
+
+// 获取所有空间统计数据的快照, key为空间名
+func (m *BECache) Stats() map[string]SpaceStats {
+    return m.stats.snapshot()
+}
+
+// 重置统计数据
+func (m *BECache) ResetStats() {
+    m.stats.reset()
+}
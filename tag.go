@@ -0,0 +1,74 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  标签
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "time"
+
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+// 删除标签关联的所有数据, 包括本地缓存和缓存数据库
+func (m *BECache) InvalidateTag(tag string) error {
+    return m.InvalidateTagWithContext(nil, tag)
+}
+
+// 删除标签关联的所有数据, 包括本地缓存和缓存数据库
+func (m *BECache) InvalidateTagWithContext(ctx context.Context, tag string) error {
+    ctx = makeContext(ctx)
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    tc, ok := m.cdb.(cachedb.ITagCacheDB)
+    if !ok {
+        return ErrTagNotSupported
+    }
+    if err := cdbDelTag(ctx, tc, tag); err != nil {
+        return zerrors.WithMessagef(err, "删除标签失败<%s>", tag)
+    }
+
+    // 本地缓存不支持标签时只能等待本地缓存过期
+    if tc, ok := m.local_cdb.(cachedb.ITagCacheDB); ok {
+        _ = cdbDelTag(ctx, tc, tag)
+    }
+    m.publish(ctx, &cachedb.InvalidationEvent{Op: cachedb.InvalidateTag, Tag: tag})
+    return nil
+}
+
+// 获取加载器为数据设置的标签
+func loaderTags(query *Query, a interface{}, loader ILoader) []string {
+    tl, ok := loader.(ITagLoader)
+    if !ok {
+        return nil
+    }
+    if a == NoEntry {
+        a = nil
+    }
+    return tl.Tags(query, a)
+}
+
+// 为数据添加标签
+func addTags(ctx context.Context, c cachedb.ICacheDB, query *Query, tags []string, ex time.Duration) error {
+    if len(tags) == 0 {
+        return nil
+    }
+
+    tc, ok := c.(cachedb.ITagCacheDB)
+    if !ok {
+        return ErrTagNotSupported
+    }
+    if cc, ok := tc.(cachedb.IContextTagCacheDB); ok {
+        return cc.AddTagsContext(ctx, query, tags, ex)
+    }
+    return tc.AddTags(query, tags, ex)
+}
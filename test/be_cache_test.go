@@ -10,8 +10,24 @@ package test
 
 import (
     "bytes"
+    "context"
+    "crypto/md5"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
     "fmt"
+    "io"
+    "io/ioutil"
     "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
     "testing"
     "time"
 
@@ -19,10 +35,21 @@ import (
     "github.com/zlyuancn/zerrors"
 
     "github.com/zlyuancn/zbec"
+    "github.com/zlyuancn/zbec/admin"
+    "github.com/zlyuancn/zbec/bloom"
+    "github.com/zlyuancn/zbec/cachedb"
     "github.com/zlyuancn/zbec/cachedb/go_cache"
+    "github.com/zlyuancn/zbec/cachedb/lru"
+    "github.com/zlyuancn/zbec/cachedb/nocache"
     "github.com/zlyuancn/zbec/cachedb/redis"
+    "github.com/zlyuancn/zbec/cachedb/redis_hash"
+    "github.com/zlyuancn/zbec/cachedb/sharded"
+    "github.com/zlyuancn/zbec/cachedb/tiered"
+    "github.com/zlyuancn/zbec/cachedb/tinylfu"
     "github.com/zlyuancn/zbec/codec"
+    "github.com/zlyuancn/zbec/metrics"
     "github.com/zlyuancn/zbec/query"
+    "github.com/zlyuancn/zbec/retry"
 )
 
 func getRedisClient(on_local_cache bool) *zbec.BECache {
@@ -52,6 +79,12 @@ func getGoCache() *zbec.BECache {
     return bec
 }
 
+func getShardedCache() *zbec.BECache {
+    cdb := sharded.New()
+    bec := zbec.New(cdb)
+    return bec
+}
+
 func TestGetAndCache(t *testing.T) {
     space := "test"
     loader := zbec.NewNameLoader(space, func(query *query.Query) (i interface{}, err error) {
@@ -62,31 +95,1967 @@ func TestGetAndCache(t *testing.T) {
     bec := getGoCache()
     bec.RegisterLoader(loader)
 
-    for i := 0; i < 10; i++ {
-        k := fmt.Sprintf("k%d", i)
-        v := fmt.Sprintf("v%d", i)
-        query := zbec.NewQuery(space, k, v)
+    for i := 0; i < 10; i++ {
+        k := fmt.Sprintf("k%d", i)
+        v := fmt.Sprintf("v%d", i)
+        query := zbec.NewQuery(space, k, v)
+
+        a := new(string)
+        err := bec.Get(query, a)
+        if err != nil {
+            t.Fatalf("%+v", err)
+        }
+
+        if *a != query.FullPath() {
+            t.Fatalf("收到的值非预期 %s: %s", query.FullPath(), *a)
+        }
+    }
+}
+
+func TestGetMulti(t *testing.T) {
+    space := "test_multi"
+    var calls int
+    loader := zbec.NewNameLoader(space, nil).SetMultiLoader(func(queries []*query.Query) ([]interface{}, []error, error) {
+        calls++
+        outs := make([]interface{}, len(queries))
+        es := make([]error, len(queries))
+        for i, q := range queries {
+            if q.Params()[0] == "none" {
+                es[i] = zbec.ErrNoEntry
+                continue
+            }
+            outs[i] = q.FullPath()
+        }
+        return outs, es, nil
+    })
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    queries := []*query.Query{
+        zbec.NewQuery(space, "k1"),
+        zbec.NewQuery(space, "none"),
+        zbec.NewQuery(space, "k2"),
+    }
+
+    for n := 0; n < 2; n++ {
+        var a []string
+        es, err := bec.GetMulti(nil, queries, &a)
+        if err != nil {
+            t.Fatalf("%+v", err)
+        }
+        if len(a) != len(queries) {
+            t.Fatalf("收到的结果数量非预期: %d", len(a))
+        }
+
+        for i, q := range queries {
+            if i == 1 {
+                if zerrors.Cause(es[i]) != zbec.ErrNoEntry {
+                    t.Fatalf("收到的错误非预期 %s: %v", q.FullPath(), es[i])
+                }
+                continue
+            }
+            if es[i] != nil {
+                t.Fatalf("%+v", es[i])
+            }
+            if a[i] != q.FullPath() {
+                t.Fatalf("收到的值非预期 %s: %s", q.FullPath(), a[i])
+            }
+        }
+    }
+
+    if calls != 1 {
+        t.Fatalf("批量加载函数调用次数非预期: %d", calls)
+    }
+}
+
+func TestSoftExpire(t *testing.T) {
+    space := "test_soft"
+    var calls int32
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        return atomic.AddInt32(&calls, 1), nil
+    }).SetExpire(time.Second, 0).SetSoftExpire(time.Millisecond * 100)
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    get := func() int32 {
+        var a int32
+        if err := bec.Get(zbec.NewQuery(space), &a); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        return a
+    }
+
+    if v := get(); v != 1 {
+        t.Fatalf("收到的值非预期: %d", v)
+    }
+
+    time.Sleep(time.Millisecond * 150)
+    if v := get(); v != 1 { // 软过期后立即返回旧数据
+        t.Fatalf("收到的值非预期: %d", v)
+    }
+
+    time.Sleep(time.Millisecond * 50)
+    if v := get(); v != 2 {
+        t.Fatalf("后台刷新后收到的值非预期: %d", v)
+    }
+}
+
+func TestGetMultiSoftExpire(t *testing.T) {
+    space := "test_multi_soft"
+    var calls int32
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        return atomic.AddInt32(&calls, 1), nil
+    }).SetExpire(time.Second, 0).SetSoftExpire(time.Millisecond * 100)
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    get := func() int32 {
+        var a []int32
+        es, err := bec.GetMulti(nil, []*query.Query{zbec.NewQuery(space)}, &a)
+        if err != nil {
+            t.Fatalf("%+v", err)
+        }
+        if es[0] != nil {
+            t.Fatalf("%+v", es[0])
+        }
+        return a[0]
+    }
+
+    if v := get(); v != 1 {
+        t.Fatalf("收到的值非预期: %d", v)
+    }
+
+    time.Sleep(time.Millisecond * 150)
+    if v := get(); v != 1 { // 软过期后立即返回旧数据
+        t.Fatalf("收到的值非预期: %d", v)
+    }
+
+    time.Sleep(time.Millisecond * 50)
+    if v := get(); v != 2 {
+        t.Fatalf("后台刷新后收到的值非预期: %d", v)
+    }
+}
+
+func TestServeStaleOnError(t *testing.T) {
+    space := "test_stale"
+    var calls int32
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        if atomic.AddInt32(&calls, 1) > 1 {
+            return nil, errors.New("db不可用")
+        }
+        return "v1", nil
+    }).SetExpire(time.Millisecond*100, 0).SetServeStaleOnError(time.Second)
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+
+    time.Sleep(time.Millisecond * 150)
+
+    a = ""
+    err := bec.Get(zbec.NewQuery(space), &a)
+    if zerrors.Cause(err) != zbec.ErrStaleData {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+    if a != "v1" {
+        t.Fatalf("收到的值非预期: %s", a)
+    }
+}
+
+func TestGetMultiServeStaleOnError(t *testing.T) {
+    space := "test_multi_stale"
+    var calls int32
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        n := atomic.AddInt32(&calls, 1)
+        if n > 2 {
+            return nil, errors.New("db不可用")
+        }
+        return fmt.Sprintf("v%d", n), nil
+    }).SetExpire(time.Millisecond*100, 0).SetServeStaleOnError(time.Second)
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    queries := []*query.Query{zbec.NewQuery(space)}
+    get := func() (string, error) {
+        var a []string
+        es, err := bec.GetMulti(nil, queries, &a)
+        if err != nil {
+            t.Fatalf("%+v", err)
+        }
+        return a[0], es[0]
+    }
+
+    if v, err := get(); err != nil || v != "v1" {
+        t.Fatalf("收到的结果非预期: %s, %v", v, err)
+    }
+
+    // 过期后加载器正常时不能返回过期数据
+    time.Sleep(time.Millisecond * 150)
+    if v, err := get(); err != nil || v != "v2" {
+        t.Fatalf("过期后收到的结果非预期: %s, %v", v, err)
+    }
+
+    // 过期后加载器失败时返回过期数据
+    time.Sleep(time.Millisecond * 150)
+    v, err := get()
+    if zerrors.Cause(err) != zbec.ErrStaleData {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+    if v != "v2" {
+        t.Fatalf("收到的值非预期: %s", v)
+    }
+}
+
+func TestLoadContext(t *testing.T) {
+    type ctxKey struct{}
+
+    space := "test_ctx"
+    loader := zbec.NewNameLoader(space, nil).SetContextLoader(func(ctx context.Context, query *query.Query) (interface{}, error) {
+        v, _ := ctx.Value(ctxKey{}).(string)
+        return v, nil
+    })
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    var a string
+    ctx := context.WithValue(context.Background(), ctxKey{}, "hello")
+    if err := bec.GetWithContext(ctx, zbec.NewQuery(space), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if a != "hello" {
+        t.Fatalf("收到的值非预期: %s", a)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if err := bec.GetWithContext(ctx, zbec.NewQuery(space, "cancel"), &a); err != context.Canceled {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+}
+
+func TestSharedLoadCancel(t *testing.T) {
+    space := "test_shared_cancel"
+    release := make(chan struct{})
+    entered := make(chan struct{})
+    loader := zbec.NewNameLoader(space, nil).SetContextLoader(func(ctx context.Context, query *query.Query) (interface{}, error) {
+        close(entered)
+        select {
+        case <-release:
+            return "v1", nil
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        }
+    })
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    // 第一个请求取消后共享的加载不会中断
+    ctx, cancel := context.WithCancel(context.Background())
+    leader := make(chan error, 1)
+    go func() {
+        var a string
+        leader <- bec.GetWithContext(ctx, zbec.NewQuery(space), &a)
+    }()
+    <-entered
+
+    waiter := make(chan string, 1)
+    go func() {
+        var a string
+        if err := bec.GetWithContext(nil, zbec.NewQuery(space), &a); err != nil {
+            t.Errorf("%+v", err)
+        }
+        waiter <- a
+    }()
+
+    cancel()
+    select {
+    case err := <-leader:
+        if err != context.Canceled {
+            t.Fatalf("收到的错误非预期: %v", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("取消ctx后没有立即返回")
+    }
+
+    close(release)
+    if a := <-waiter; a != "v1" {
+        t.Fatalf("收到的值非预期: %s", a)
+    }
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space), &a); err != nil || a != "v1" {
+        t.Fatalf("数据没有写入缓存: %s, %v", a, err)
+    }
+}
+
+func TestGetMultiContextLoader(t *testing.T) {
+    type ctxKey struct{}
+
+    space := "test_multi_ctx"
+    loader := zbec.NewNameLoader(space, nil).SetContextLoader(func(ctx context.Context, query *query.Query) (interface{}, error) {
+        v, _ := ctx.Value(ctxKey{}).(string)
+        return v + query.Params()[0], nil
+    })
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    queries := []*query.Query{
+        zbec.NewQuery(space, "k1"),
+        zbec.NewQuery(space, "k2"),
+    }
+
+    var a []string
+    ctx := context.WithValue(context.Background(), ctxKey{}, "hello_")
+    es, err := bec.GetMulti(ctx, queries, &a)
+    if err != nil {
+        t.Fatalf("%+v", err)
+    }
+    for i, e := range es {
+        if e != nil {
+            t.Fatalf("第%d个query收到错误: %+v", i, e)
+        }
+    }
+    if len(a) != 2 || a[0] != "hello_k1" || a[1] != "hello_k2" {
+        t.Fatalf("收到的值非预期: %v", a)
+    }
+
+    // 支持上下文的批量加载函数
+    space = "test_multi_ctx_batch"
+    bec.RegisterLoader(zbec.NewNameLoader(space, nil).SetMultiContextLoader(func(ctx context.Context, queries []*query.Query) ([]interface{}, []error, error) {
+        v, _ := ctx.Value(ctxKey{}).(string)
+        outs := make([]interface{}, len(queries))
+        for i, q := range queries {
+            outs[i] = v + q.Params()[0]
+        }
+        return outs, make([]error, len(queries)), nil
+    }))
+
+    a = nil
+    queries = []*query.Query{
+        zbec.NewQuery(space, "k1"),
+        zbec.NewQuery(space, "k2"),
+    }
+    if _, err = bec.GetMulti(ctx, queries, &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if len(a) != 2 || a[0] != "hello_k1" || a[1] != "hello_k2" {
+        t.Fatalf("收到的值非预期: %v", a)
+    }
+}
+
+func TestRedisContext(t *testing.T) {
+    srv := newTestRedis(t)
+    defer srv.Close()
+    client := srv.Client()
+    defer client.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    q := zbec.NewQuery("test_redis_ctx", "1")
+    for _, cdb := range []cachedb.ICacheDB{redis.Wrap(client), redis_hash.Wrap(client)} {
+        if err := cdb.Set(q, "1", 0); err != nil {
+            t.Fatalf("%+v", err)
+        }
+
+        _, es := cdb.(cachedb.IContextBatchCacheDB).MGetContext(ctx, []*query.Query{q}, []interface{}{new(string)})
+        if zerrors.Cause(es[0]) != context.Canceled {
+            t.Fatalf("收到的错误非预期: %v", es[0])
+        }
+        if _, err := cdb.(cachedb.IContextTTLCacheDB).TTLContext(ctx, q); zerrors.Cause(err) != context.Canceled {
+            t.Fatalf("收到的错误非预期: %v", err)
+        }
+        if err := cdb.(cachedb.IContextTagCacheDB).AddTagsContext(ctx, q, []string{"t"}, 0); zerrors.Cause(err) != context.Canceled {
+            t.Fatalf("收到的错误非预期: %v", err)
+        }
+        if err := cdb.(cachedb.IContextTagCacheDB).DelTagContext(ctx, "t"); zerrors.Cause(err) != context.Canceled {
+            t.Fatalf("收到的错误非预期: %v", err)
+        }
+        if err := cdb.(cachedb.IContextSpaceCacheDB).DelSpaceDataContext(ctx, q.Space()); zerrors.Cause(err) != context.Canceled {
+            t.Fatalf("收到的错误非预期: %v", err)
+        }
+        if _, err := cdb.Get(q, new(string)); err != nil {
+            t.Fatalf("数据被删除了: %v", err)
+        }
+    }
+}
+
+func TestStats(t *testing.T) {
+    space := "test_stats"
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        if len(query.Params()) == 0 {
+            return nil, zbec.ErrNoEntry
+        }
+        return query.Params()[0], nil
+    })
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader)
+
+    var a string
+    for i := 0; i < 3; i++ {
+        _ = bec.Get(zbec.NewQuery(space, "v"), &a)
+        _ = bec.Get(zbec.NewQuery(space), &a)
+    }
+
+    stats := bec.Stats()[space]
+    if stats.LoaderCalls != 2 || stats.CacheHits != 2 || stats.NoEntryHits != 2 || stats.LoaderErrors != 0 {
+        t.Fatalf("统计数据非预期: %+v", stats)
+    }
+
+    bec.ResetStats()
+    if len(bec.Stats()) != 0 {
+        t.Fatalf("重置统计数据失败")
+    }
+}
+
+func TestMetricsExporter(t *testing.T) {
+    space := "test_metrics"
+    bec := getGoCache()
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        return "v", nil
+    }))
+
+    var a string
+    _ = bec.Get(zbec.NewQuery(space), &a)
+
+    collector := metrics.NewCacheDBCollector("redis")
+    collector.Observe("get", time.Millisecond*3, nil)
+    collector.Observe("get", time.Millisecond*3, errors.New("err"))
+
+    exporter := metrics.NewExporter()
+    exporter.RegisterBECache("default", bec)
+    exporter.RegisterCacheDB(collector)
+
+    var buf bytes.Buffer
+    if _, err := exporter.WriteTo(&buf); err != nil {
+        t.Fatalf("%+v", err)
+    }
+
+    for _, line := range []string{
+        `zbec_loader_calls_total{bec="default",space="test_metrics"} 1`,
+        `zbec_loader_latency_seconds_count{bec="default",space="test_metrics"} 1`,
+        `zbec_cachedb_errors_total{cachedb="redis",op="get"} 1`,
+        `zbec_cachedb_latency_seconds_bucket{cachedb="redis",op="get",le="0.0025"} 0`,
+        `zbec_cachedb_latency_seconds_bucket{cachedb="redis",op="get",le="0.005"} 2`,
+    } {
+        if !strings.Contains(buf.String(), line+"\n") {
+            t.Fatalf("输出中没有找到 %s\n%s", line, buf.String())
+        }
+    }
+}
+
+func TestInterceptor(t *testing.T) {
+    space := "test_interceptor"
+    var stages []zbec.Stage
+    bec := zbec.NewOfGoCache(0, zbec.WithInterceptor(func(ctx context.Context, stage zbec.Stage, query *query.Query, next zbec.Handler) (interface{}, error) {
+        stages = append(stages, stage)
+        if stage == zbec.StageDel {
+            return nil, errors.New("禁止删除")
+        }
+        return next(ctx, query)
+    }))
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        return "v", nil
+    }))
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.DelData(zbec.NewQuery(space)); err == nil {
+        t.Fatalf("拦截器没有生效")
+    }
+
+    expect := []zbec.Stage{zbec.StageGet, zbec.StageLoad, zbec.StageSet, zbec.StageDel}
+    if fmt.Sprint(stages) != fmt.Sprint(expect) {
+        t.Fatalf("拦截的阶段非预期: %v", stages)
+    }
+}
+
+func TestGetMultiInterceptor(t *testing.T) {
+    space := "test_multi_interceptor"
+    var mx sync.Mutex
+    stages := make(map[string][]zbec.Stage)
+    tracer := new(testTracer)
+    bec := zbec.NewOfGoCache(0, zbec.WithTracer(tracer), zbec.WithInterceptor(func(ctx context.Context, stage zbec.Stage, query *query.Query, next zbec.Handler) (interface{}, error) {
+        mx.Lock()
+        stages[query.FullPath()] = append(stages[query.FullPath()], stage)
+        mx.Unlock()
+        if stage == zbec.StageGet && query.Params()[0] == "deny" {
+            return nil, errors.New("禁止获取")
+        }
+        return next(ctx, query)
+    }))
+
+    var loaded []string
+    bec.RegisterLoader(zbec.NewNameLoader(space, nil).SetMultiLoader(func(queries []*query.Query) ([]interface{}, []error, error) {
+        outs := make([]interface{}, len(queries))
+        for i, q := range queries {
+            loaded = append(loaded, q.FullPath())
+            outs[i] = q.FullPath()
+        }
+        return outs, nil, nil
+    }))
+
+    queries := []*query.Query{
+        zbec.NewQuery(space, "k1"),
+        zbec.NewQuery(space, "deny"),
+        zbec.NewQuery(space, "k2"),
+    }
+    var a []string
+    es, err := bec.GetMulti(nil, queries, &a)
+    if err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if es[0] != nil || es[2] != nil || a[0] != queries[0].FullPath() || a[2] != queries[2].FullPath() {
+        t.Fatalf("收到的结果非预期: %v %v", a, es)
+    }
+    if es[1] == nil || a[1] != "" {
+        t.Fatalf("拦截器没有生效: %v %v", a[1], es[1])
+    }
+    if fmt.Sprint(loaded) != fmt.Sprint([]string{queries[0].FullPath(), queries[2].FullPath()}) {
+        t.Fatalf("加载的条目非预期: %v", loaded)
+    }
+
+    expect := map[string][]zbec.Stage{
+        queries[0].FullPath(): {zbec.StageGet, zbec.StageLoad, zbec.StageSet},
+        queries[1].FullPath(): {zbec.StageGet},
+        queries[2].FullPath(): {zbec.StageGet, zbec.StageLoad, zbec.StageSet},
+    }
+    if fmt.Sprint(stages) != fmt.Sprint(expect) {
+        t.Fatalf("拦截的阶段非预期: %v", stages)
+    }
+
+    var loadSpans int
+    for _, span := range tracer.spans {
+        if span.name == zbec.SpanLoad {
+            loadSpans++
+            if span.attrs[zbec.AttrQueryCount] != 2 {
+                t.Fatalf("span属性非预期: %v", span.attrs)
+            }
+        }
+    }
+    if loadSpans != 1 {
+        t.Fatalf("加载span数量非预期: %d", loadSpans)
+    }
+}
+
+// go test -v -bench "^Benchmark_.+$" -run ^$ -cpu 20,50,100,1000,10000 .
+// docker run --rm -v $PWD/../..:/src/app -v /src/gopath:/src/gopath -v /src/gocache:/src/gocache -w /src/app/zbec/test zlyuan/golang:1.13 go test -v -bench "^Benchmark_.+$" -run ^$ -cpu 20,50,100,1000,10000 .
+
+type testSpan struct {
+    name  string
+    attrs map[string]interface{}
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) RecordError(err error)                      { s.attrs["error"] = err }
+func (s *testSpan) End()                                       {}
+
+type testTracer struct {
+    spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, zbec.ISpan) {
+    span := &testSpan{name: name, attrs: make(map[string]interface{})}
+    t.spans = append(t.spans, span)
+    return ctx, span
+}
+
+func TestTracer(t *testing.T) {
+    space := "test_tracer"
+    tracer := new(testTracer)
+    bec := zbec.NewOfGoCache(0, zbec.WithTracer(tracer))
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        return "v", nil
+    }))
+
+    var a string
+    for _, from := range []zbec.ServedFrom{zbec.ServedFromLoader, zbec.ServedFromCacheDB} {
+        tracer.spans = nil
+        if err := bec.Get(zbec.NewQuery(space), &a); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        if tracer.spans[0].name != zbec.SpanGet || tracer.spans[0].attrs[zbec.AttrServedFrom] != string(from) {
+            t.Fatalf("数据来源非预期: %v", tracer.spans[0].attrs)
+        }
+        if tracer.spans[0].attrs[zbec.AttrSpace] != space {
+            t.Fatalf("空间属性非预期: %v", tracer.spans[0].attrs)
+        }
+    }
+
+    tracer.spans = nil
+    bec.DelData(zbec.NewQuery(space))
+    _ = bec.Get(zbec.NewQuery(space), &a)
+    var names []string
+    for _, span := range tracer.spans {
+        names = append(names, span.name)
+    }
+    expect := []string{zbec.SpanGet, zbec.SpanSingleFlight, zbec.SpanLocalGet, zbec.SpanRemoteGet, zbec.SpanLoad, zbec.SpanWriteBack}
+    if fmt.Sprint(names) != fmt.Sprint(expect) {
+        t.Fatalf("span非预期: %v", names)
+    }
+}
+
+var _ zbec.ILoadSingleFlight = (*redis.SingleFlight)(nil)
+
+// 模拟锁被其它进程持有, 等待期间其它进程将数据写入了缓存
+type otherProcessSingleFlight struct {
+    zbec.ISingleFlight
+    bec *zbec.BECache
+}
+
+func (m *otherProcessSingleFlight) DoLoad(ctx context.Context, key string, load func() (interface{}, error), recheck func() (interface{}, bool, error)) (interface{}, error) {
+    if _, ok, _ := recheck(); ok {
+        return nil, errors.New("数据还没有写入缓存")
+    }
+    if err := m.bec.Set(zbec.NewQuery("test_load_single_flight"), "other", 0); err != nil {
+        return nil, err
+    }
+    out, ok, err := recheck()
+    if !ok {
+        return load()
+    }
+    return out, err
+}
+
+func TestLoadSingleFlight(t *testing.T) {
+    space := "test_load_single_flight"
+    sf := &otherProcessSingleFlight{ISingleFlight: zbec.NoSingalFlight()}
+    bec := zbec.NewOfGoCache(0, zbec.WithSingleFlight(sf))
+    sf.bec = bec
+
+    var calls int32
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        atomic.AddInt32(&calls, 1)
+        return "self", nil
+    }))
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if a != "other" || atomic.LoadInt32(&calls) != 0 {
+        t.Fatalf("没有使用其它进程加载的数据: %s, 加载器调用次数: %d", a, calls)
+    }
+}
+
+func TestRedisSingleFlight(t *testing.T) {
+    srv := newTestRedis(t)
+    defer srv.Close()
+
+    // 两个进程同时未命中缓存时只有一个进程调用加载器
+    space := "test_redis_single_flight"
+    var calls int32
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        atomic.AddInt32(&calls, 1)
+        time.Sleep(time.Millisecond * 100)
+        return "v1", nil
+    })
+    var becs []*zbec.BECache
+    for i := 0; i < 2; i++ {
+        client := srv.Client()
+        defer client.Close()
+        bec := zbec.New(redis.Wrap(client), zbec.WithSingleFlight(redis.NewSingleFlight(client, redis.WithLockPollInterval(time.Millisecond*10))))
+        bec.RegisterLoader(loader)
+        becs = append(becs, bec)
+    }
+
+    errs := make(chan error, len(becs))
+    for _, bec := range becs {
+        go func(bec *zbec.BECache) {
+            var a string
+            err := bec.Get(zbec.NewQuery(space), &a)
+            if err == nil && a != "v1" {
+                err = fmt.Errorf("收到的值非预期: %s", a)
+            }
+            errs <- err
+        }(bec)
+    }
+    for range becs {
+        if err := <-errs; err != nil {
+            t.Fatalf("%+v", err)
+        }
+    }
+    if n := atomic.LoadInt32(&calls); n != 1 {
+        t.Fatalf("加载器调用次数非预期: %d", n)
+    }
+    for _, key := range srv.Keys() {
+        if strings.HasPrefix(key, redis.DefaultLockKeyPrefix) {
+            t.Fatalf("加载完成后锁没有被释放: %s", key)
+        }
+    }
+
+    // 其它进程在检查后写入数据并释放锁时不会再次加载
+    client := srv.Client()
+    defer client.Close()
+    sf := redis.NewSingleFlight(client, redis.WithLockPollInterval(time.Millisecond*10))
+    lockKey := redis.DefaultLockKeyPrefix + fmt.Sprintf("%x", md5Sum("key"))
+    srv.Set(lockKey, "other")
+    var rechecks int32
+    out, err := sf.DoLoad(context.Background(), "key", func() (interface{}, error) {
+        return nil, errors.New("不应该调用加载函数")
+    }, func() (interface{}, bool, error) {
+        if atomic.AddInt32(&rechecks, 1) == 1 {
+            srv.Del(lockKey) // 检查后其它进程才写入数据并释放锁
+            return nil, false, nil
+        }
+        return "other", true, nil
+    })
+    if err != nil || out != "other" {
+        t.Fatalf("收到的结果非预期: %v, %v", out, err)
+    }
+
+    // 其它进程加载失败释放锁后不会再次加载, 有过期数据时返回过期数据
+    staleSpace := "test_redis_single_flight_stale"
+    calls = 0
+    bec := zbec.New(redis.Wrap(client), zbec.WithSingleFlight(sf))
+    bec.RegisterLoader(zbec.NewNameLoader(staleSpace, func(query *query.Query) (interface{}, error) {
+        if atomic.AddInt32(&calls, 1) > 1 {
+            return nil, errors.New("db不可用")
+        }
+        return "v1", nil
+    }).SetExpire(time.Minute, 0).SetServeStaleOnError(time.Hour))
+    var a string
+    if err := bec.Get(zbec.NewQuery(staleSpace), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    srv.FastForward(time.Minute * 2)
+
+    staleLock := redis.DefaultLockKeyPrefix + fmt.Sprintf("%x", md5Sum(zbec.NewQuery(staleSpace).FullPath()))
+    srv.Set(staleLock, "other")
+    go func() {
+        time.Sleep(time.Millisecond * 50)
+        srv.Del(staleLock)
+    }()
+    a = ""
+    start := time.Now()
+    err = bec.Get(zbec.NewQuery(staleSpace), &a)
+    if zerrors.Cause(err) != zbec.ErrStaleData || a != "v1" {
+        t.Fatalf("收到的结果非预期: %s, %v", a, err)
+    }
+    if n := atomic.LoadInt32(&calls); n != 1 || time.Since(start) > time.Second {
+        t.Fatalf("加载器调用次数非预期: %d, 耗时: %s", n, time.Since(start))
+    }
+
+    // 没有过期数据时返回错误
+    srv.Set(lockKey, "other")
+    go func() {
+        time.Sleep(time.Millisecond * 50)
+        srv.Del(lockKey)
+    }()
+    out, err = sf.DoLoad(context.Background(), "key", func() (interface{}, error) {
+        return nil, errors.New("不应该调用加载函数")
+    }, func() (interface{}, bool, error) {
+        return nil, false, nil
+    })
+    if err != redis.ErrLockHolderFailed || out != nil {
+        t.Fatalf("收到的结果非预期: %v, %v", out, err)
+    }
+
+    // redis不可用时报告错误并直接加载
+    var reported int32
+    sf = redis.NewSingleFlight(client, redis.WithLockErrorHandler(func(err error) {
+        atomic.AddInt32(&reported, 1)
+    }))
+    srv.Close()
+    out, err = sf.DoLoad(context.Background(), "key", func() (interface{}, error) {
+        return "self", nil
+    }, func() (interface{}, bool, error) {
+        return nil, false, nil
+    })
+    if err != nil || out != "self" || atomic.LoadInt32(&reported) == 0 {
+        t.Fatalf("收到的结果非预期: %v, %v, 报告错误次数: %d", out, err, reported)
+    }
+}
+
+func TestInvalidateTag(t *testing.T) {
+    bec := zbec.NewOfGoCache(0)
+    version := "v1"
+    for _, space := range []string{"test_tag_profile", "test_tag_settings"} {
+        bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+            return version, nil
+        }).SetTags(func(query *query.Query, a interface{}) []string {
+            return []string{"user:" + query.Params()[0]}
+        }))
+    }
+    bec.RegisterLoader(zbec.NewNameLoader("test_tag_other", func(query *query.Query) (interface{}, error) {
+        return nil, zbec.ErrNoEntry
+    }))
+    if err := bec.SetWithTags(nil, zbec.NewQuery("test_tag_other", "1"), "v1", []string{"user:1"}); err != nil {
+        t.Fatalf("%+v", err)
+    }
+
+    get := func(space string) string {
+        var a string
+        if err := bec.Get(zbec.NewQuery(space, "1"), &a); err != nil && zerrors.Cause(err) != zbec.ErrNoEntry {
+            t.Fatalf("%+v", err)
+        }
+        return a
+    }
+    for _, space := range []string{"test_tag_profile", "test_tag_settings"} {
+        _ = get(space)
+    }
+
+    version = "v2"
+    if err := bec.InvalidateTag("user:1"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    for _, space := range []string{"test_tag_profile", "test_tag_settings"} {
+        if a := get(space); a != "v2" {
+            t.Fatalf("标签关联的数据没有被删除<%s>: %s", space, a)
+        }
+    }
+    if a := get("test_tag_other"); a != "" {
+        t.Fatalf("标签关联的数据没有被删除<test_tag_other>: %s", a)
+    }
+
+    // 删除空间数据时从标签索引中移除空间的条目, 之后重新写入的数据不会再被标签删除
+    q := zbec.NewQuery("test_tag_other", "2")
+    if err := bec.SetWithTags(nil, q, "v1", []string{"user:2"}); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.DelSpaceData("test_tag_other"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.Set(q, "v2"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.InvalidateTag("user:2"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    var a string
+    if err := bec.Get(q, &a); err != nil || a != "v2" {
+        t.Fatalf("删除空间数据后标签索引没有被清理: %s, %v", a, err)
+    }
+}
+
+func TestRedisHashTag(t *testing.T) {
+    srv := newTestRedis(t)
+    defer srv.Close()
+    client := srv.Client()
+    defer client.Close()
+
+    space := "test_redis_hash_tag"
+    bec := zbec.New(redis_hash.Wrap(client))
+    q1, q2 := zbec.NewQuery(space, "1"), zbec.NewQuery(space, "2")
+    if err := bec.SetWithTags(nil, q1, "v1", []string{"t1", "t2"}, time.Minute); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.SetWithTags(nil, q2, "v2", []string{"t1"}, time.Hour); err != nil {
+        t.Fatalf("%+v", err)
+    }
+
+    // hash的字段没有有效时间, 标签索引也不会过期
+    if ttl := srv.TTL(redis_hash.TagKeyPrefix + "t1"); ttl != 0 {
+        t.Fatalf("标签索引的有效时间非预期: %s", ttl)
+    }
+
+    // 删除数据时从标签索引中移除成员
+    if err := bec.DelData(q1); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if members := srv.Members(redis_hash.TagKeyPrefix + "t1"); len(members) != 1 {
+        t.Fatalf("标签索引的成员非预期: %v", members)
+    }
+    if srv.Exists(redis_hash.TagKeyPrefix + "t2") {
+        t.Fatal("标签索引没有被删除")
+    }
+    for _, key := range srv.Keys() {
+        if strings.HasPrefix(key, redis_hash.MemberTagsKeyPrefix) && !strings.HasSuffix(key, redis_hash.MakeField(q2, true)) {
+            t.Fatalf("数据的标签集合没有被删除: %s", key)
+        }
+    }
+
+    if err := bec.InvalidateTag("t1"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    var a string
+    if err := bec.GetWithLoaderFn(nil, q2, &a, func(query *query.Query) (interface{}, error) {
+        return nil, zbec.ErrNoEntry
+    }); zerrors.Cause(err) != zbec.ErrNoEntry {
+        t.Fatalf("通过标签删除数据失败: %v", err)
+    }
+    if keys := srv.Keys(); len(keys) != 1 || keys[0] != space {
+        t.Fatalf("剩余的key非预期: %v", keys)
+    }
+
+    // 删除空间数据时从标签索引中移除空间的所有字段
+    if err := bec.SetWithTags(nil, q1, "v1", []string{"t1"}); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.SetWithTags(nil, zbec.NewQuery("test_redis_hash_tag_other"), "v", []string{"t1"}); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.DelSpaceData(space); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if members := srv.Members(redis_hash.TagKeyPrefix + "t1"); len(members) != 1 || !strings.Contains(members[0], "test_redis_hash_tag_other") {
+        t.Fatalf("标签索引的成员非预期: %v", members)
+    }
+    for _, key := range srv.Keys() {
+        if strings.HasPrefix(key, redis_hash.MemberTagsKeyPrefix) && strings.HasSuffix(key, redis_hash.MakeField(q1, true)) {
+            t.Fatalf("数据的标签集合没有被删除: %s", key)
+        }
+    }
+}
+
+func TestLRU(t *testing.T) {
+    c := lru.New(lru.WithMaxEntries(3))
+    for i := 0; i < 3; i++ {
+        _ = c.Set(zbec.NewQuery("test_lru", strconv.Itoa(i)), i, 0)
+    }
+    _, _ = c.Get(zbec.NewQuery("test_lru", "0"), nil)
+    _ = c.Set(zbec.NewQuery("test_lru_other", "3"), 3, 0)
+
+    if _, err := c.Get(zbec.NewQuery("test_lru", "1"), nil); err != zbec.ErrNoEntry {
+        t.Fatalf("最久没有使用的条目没有被淘汰")
+    }
+    if out, err := c.Get(zbec.NewQuery("test_lru", "0"), nil); err != nil || out != 0 {
+        t.Fatalf("最近使用的条目被淘汰了")
+    }
+    usage := c.Usage()
+    if usage["test_lru"].Entries != 2 || usage["test_lru_other"].Entries != 1 || usage["test_lru"].Bytes <= 0 {
+        t.Fatalf("空间占用非预期: %v", usage)
+    }
+
+    _ = c.DelSpaceData("test_lru")
+    if c.Len() != 1 || c.Bytes() != c.Usage()["test_lru_other"].Bytes {
+        t.Fatalf("删除空间数据后的占用非预期: %v", c.Usage())
+    }
+
+    c = lru.New(lru.WithMaxEntries(0), lru.WithMaxBytes(1024))
+    for i := 0; i < 100; i++ {
+        _ = c.Set(zbec.NewQuery("test_lru", strconv.Itoa(i)), strings.Repeat("a", 100), 0)
+    }
+    if c.Bytes() > 1024 || c.Len() == 0 {
+        t.Fatalf("超过了最大字节数: %d", c.Bytes())
+    }
+
+    bec := zbec.NewOfGoCache(0, zbec.WithLocalCacheDB(c))
+    bec.RegisterLoader(zbec.NewNameLoader("test_lru_bec", func(query *query.Query) (interface{}, error) {
+        return "v", nil
+    }))
+    var a string
+    if err := bec.Get(zbec.NewQuery("test_lru_bec"), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if _, err := c.Get(zbec.NewQuery("test_lru_bec"), nil); err != nil {
+        t.Fatalf("没有写入本地缓存: %v", err)
+    }
+}
+
+func TestTinyLFU(t *testing.T) {
+    c := tinylfu.New(tinylfu.WithMaxEntries(100))
+    for i := 0; i < 50; i++ {
+        q := zbec.NewQuery("test_tinylfu_hot", strconv.Itoa(i))
+        _ = c.Set(q, i, 0)
+        for j := 0; j < 5; j++ {
+            _, _ = c.Get(q, nil)
+        }
+    }
+
+    // 只访问一次的条目不应该挤掉热点条目
+    for i := 0; i < 1000; i++ {
+        q := zbec.NewQuery("test_tinylfu_scan", strconv.Itoa(i))
+        _, _ = c.Get(q, nil)
+        _ = c.Set(q, i, 0)
+        if i%10 == 0 {
+            _, _ = c.Get(zbec.NewQuery("test_tinylfu_hot", strconv.Itoa(i/10%50)), nil)
+        }
+    }
+
+    hits := 0
+    for i := 0; i < 50; i++ {
+        if _, err := c.Get(zbec.NewQuery("test_tinylfu_hot", strconv.Itoa(i)), nil); err == nil {
+            hits++
+        }
+    }
+    if hits < 40 {
+        t.Fatalf("热点条目被挤掉了, 剩余: %d", hits)
+    }
+    if c.Len() > 100 {
+        t.Fatalf("超过了最大条目数量: %d", c.Len())
+    }
+
+    _ = c.DelSpaceData("test_tinylfu_hot")
+    if _, err := c.Get(zbec.NewQuery("test_tinylfu_hot", "0"), nil); err != zbec.ErrNoEntry {
+        t.Fatalf("删除空间数据失败")
+    }
+    if c.Len() > 100-hits {
+        t.Fatalf("删除空间数据后的条目数量非预期: %d", c.Len())
+    }
+}
+
+func TestShardedCache(t *testing.T) {
+    c := sharded.New(sharded.WithShards(4), sharded.WithWheel(time.Millisecond*10, 8))
+    defer c.Close()
+
+    for i := 0; i < 100; i++ {
+        _ = c.Set(zbec.NewQuery("test_sharded", strconv.Itoa(i)), i, time.Millisecond*30)
+        _ = c.Set(zbec.NewQuery("test_sharded_other", strconv.Itoa(i)), i, 0)
+    }
+    if out, err := c.Get(zbec.NewQuery("test_sharded", "1"), nil); err != nil || out != 1 {
+        t.Fatalf("获取数据失败: %v, %v", out, err)
+    }
+    if ttl, err := c.TTL(zbec.NewQuery("test_sharded_other", "1")); err != nil || ttl != -1 {
+        t.Fatalf("永不过期的ttl非预期: %v, %v", ttl, err)
+    }
+
+    time.Sleep(time.Millisecond * 100)
+    if c.Len() != 100 {
+        t.Fatalf("时间轮没有清理过期的条目: %d", c.Len())
+    }
+
+    _ = c.DelSpaceData("test_sharded_other")
+    if c.Len() != 0 {
+        t.Fatalf("删除空间数据失败: %d", c.Len())
+    }
+}
+
+func TestTieredCache(t *testing.T) {
+    top, middle, bottom := lru.New(), lru.New(), go_cache.NewGoCache(0)
+    c := tiered.New(
+        tiered.WithTier(top, time.Second),
+        tiered.WithTier(middle, time.Minute),
+        tiered.WithTier(bottom, 0),
+    )
+
+    q := zbec.NewQuery("test_tiered", "1")
+    _ = bottom.Set(q, "v1", time.Hour)
+    if out, err := c.Get(q, nil); err != nil || out != "v1" {
+        t.Fatalf("获取数据失败: %v, %v", out, err)
+    }
+    if ttl, _ := top.TTL(q); ttl <= 0 || ttl > time.Second {
+        t.Fatalf("上层回填的有效时间非预期: %v", ttl)
+    }
+    if ttl, _ := middle.TTL(q); ttl <= time.Second || ttl > time.Minute {
+        t.Fatalf("中层回填的有效时间非预期: %v", ttl)
+    }
+    if ttl, _ := c.TTL(q); ttl <= time.Minute {
+        t.Fatalf("有效时间应该来自最下层: %v", ttl)
+    }
+
+    _ = c.Set(q, "v2", time.Hour)
+    for i, cdb := range []cachedb.ICacheDB{top, middle, bottom} {
+        if out, _ := cdb.Get(q, nil); out != "v2" {
+            t.Fatalf("第%d层没有写入: %v", i, out)
+        }
+    }
+
+    c = tiered.New(
+        tiered.WithTier(top, time.Second),
+        tiered.WithTier(bottom, 0),
+        tiered.WithWritePolicy(tiered.WriteInvalidateUpper),
+        tiered.WithDeletePolicy(tiered.DeleteBottomOnly),
+    )
+    _ = c.Set(q, "v3", time.Hour)
+    if _, err := top.Get(q, nil); err != zbec.ErrNoEntry {
+        t.Fatalf("上层数据没有被删除")
+    }
+    if out, _ := c.Get(q, nil); out != "v3" {
+        t.Fatalf("获取数据失败: %v", out)
+    }
+    _ = c.Del(q)
+    if out, _ := top.Get(q, nil); out != "v3" {
+        t.Fatalf("只删除最下层时上层数据不应该被删除")
+    }
+    if _, err := bottom.Get(q, nil); err != zbec.ErrNoEntry {
+        t.Fatalf("最下层数据没有被删除")
+    }
+}
+
+var _ cachedb.IInvalidationBus = (*redis.InvalidationBus)(nil)
+
+// 进程内的失效总线, 模拟多个进程订阅同一个频道
+type memoryBus struct {
+    handlers []func(event *cachedb.InvalidationEvent)
+}
+
+func (m *memoryBus) Publish(ctx context.Context, event *cachedb.InvalidationEvent) error {
+    for _, handler := range m.handlers {
+        handler(event)
+    }
+    return nil
+}
+
+func (m *memoryBus) Subscribe(handler func(event *cachedb.InvalidationEvent)) error {
+    m.handlers = append(m.handlers, handler)
+    return nil
+}
+
+func TestInvalidationBus(t *testing.T) {
+    space := "test_bus"
+    cdb := go_cache.NewGoCache(0)
+    bus := new(memoryBus)
+    becs := make([]*zbec.BECache, 2)
+    version := "v1"
+    for i := range becs {
+        becs[i] = zbec.New(cdb, zbec.WithLocalCache(true, time.Hour), zbec.WithInvalidationBus(bus))
+        becs[i].RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+            return version, nil
+        }))
+    }
+
+    var a string
+    for _, bec := range becs {
+        if err := bec.Get(zbec.NewQuery(space, "1"), &a); err != nil {
+            t.Fatalf("%+v", err)
+        }
+    }
+
+    version = "v2"
+    if err := becs[0].DelData(zbec.NewQuery(space, "1")); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := becs[1].Get(zbec.NewQuery(space, "1"), &a); err != nil || a != "v2" {
+        t.Fatalf("其它进程的本地缓存没有被删除: %s, %v", a, err)
+    }
+
+    if err := becs[0].Set(zbec.NewQuery(space, "1"), "v3"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := becs[1].Get(zbec.NewQuery(space, "1"), &a); err != nil || a != "v3" {
+        t.Fatalf("其它进程的本地缓存没有被删除: %s, %v", a, err)
+    }
+
+    // 再次设置选项不会重复订阅
+    becs[0].SetOptions(zbec.WithLocalCache(true, time.Minute))
+    if n := len(bus.handlers); n != 2 {
+        t.Fatalf("订阅次数非预期: %d", n)
+    }
+}
+
+type failBus struct {
+    memoryBus
+}
+
+func (m *failBus) Subscribe(handler func(event *cachedb.InvalidationEvent)) error {
+    return errors.New("订阅失败")
+}
+
+type recordLogger struct {
+    errors []interface{}
+}
+
+func (m *recordLogger) Info(v ...interface{})  {}
+func (m *recordLogger) Warn(v ...interface{})  {}
+func (m *recordLogger) Error(v ...interface{}) { m.errors = append(m.errors, v...) }
+
+func TestInvalidationBusSubscribeError(t *testing.T) {
+    // 订阅失败的日志使用后面设置的日志组件
+    log := new(recordLogger)
+    _ = zbec.NewOfNoCache(zbec.WithInvalidationBus(new(failBus)), zbec.WithLogger(log))
+    if len(log.errors) != 1 {
+        t.Fatalf("日志非预期: %v", log.errors)
+    }
+}
+
+func TestRedisInvalidationBus(t *testing.T) {
+    srv := newTestRedis(t)
+    defer srv.Close()
+
+    space := "test_redis_bus"
+    cdb := go_cache.NewGoCache(0)
+    locals := make([]*lru.Cache, 2)
+    becs := make([]*zbec.BECache, 2)
+    for i := range becs {
+        client := srv.Client()
+        defer client.Close()
+        bus := redis.NewInvalidationBus(client, redis.WithReconnectInterval(time.Millisecond*10), redis.WithBusErrorHandler(func(err error) {}))
+        defer bus.Close()
+        locals[i] = lru.New()
+        becs[i] = zbec.New(cdb, zbec.WithLocalCacheDB(locals[i], time.Hour), zbec.WithInvalidationBus(bus))
+    }
+    waitFor := func(msg string, fn func() bool) {
+        for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond * 5) {
+            if fn() {
+                return
+            }
+        }
+        t.Fatal(msg)
+    }
+    inLocal := func(local *lru.Cache, q *query.Query) bool {
+        _, err := local.Get(q, new(string))
+        return err == nil
+    }
+
+    // 设置数据后其它进程删除本地缓存
+    q1 := zbec.NewQuery(space, "1")
+    if err := becs[1].Set(q1, "v1"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    waitFor("订阅没有生效", func() bool {
+        _ = locals[1].Set(q1, "stale", 0)
+        if err := becs[0].Set(q1, "v2"); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        time.Sleep(time.Millisecond * 5)
+        return !inLocal(locals[1], q1)
+    })
+
+    // 重新连接后清除没有注册加载器的空间的本地缓存
+    q2 := zbec.NewQuery(space+"_fn", "1")
+    var a string
+    if err := becs[1].GetWithLoaderFn(nil, q2, &a, func(query *query.Query) (interface{}, error) {
+        return "v1", nil
+    }); err != nil || !inLocal(locals[1], q2) {
+        t.Fatalf("数据没有写入本地缓存: %v", err)
+    }
+    srv.CloseClients()
+    waitFor("重新连接后没有清除本地缓存", func() bool {
+        return !inLocal(locals[1], q2)
+    })
+}
+
+func TestBloomFilter(t *testing.T) {
+    space := "test_bloom"
+    filter := bloom.New(1000, 0.001)
+    bec := zbec.New(go_cache.NewGoCache(0), zbec.WithBloomFilter(space, filter))
+
+    var loads int32
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        atomic.AddInt32(&loads, 1)
+        id, _ := strconv.Atoi(query.Params()[0])
+        if id >= 100 {
+            return nil, zbec.ErrNoEntry
+        }
+        return &id, nil
+    }).SetKeys(func(ctx context.Context, fn func(query *query.Query) error) error {
+        for i := 0; i < 100; i++ {
+            if err := fn(zbec.NewQuery(space, strconv.Itoa(i))); err != nil {
+                return err
+            }
+        }
+        return nil
+    }))
+
+    // 没有构建过的过滤器不会拦截
+    var a int
+    if err := bec.Get(zbec.NewQuery(space, "1"), &a); err != nil || a != 1 {
+        t.Fatalf("加载失败: %d, %v", a, err)
+    }
+
+    if err := bec.RebuildBloomFilter(nil, space); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    atomic.StoreInt32(&loads, 0)
+    for i := 1000; i < 1100; i++ {
+        if err := bec.Get(zbec.NewQuery(space, strconv.Itoa(i)), &a); zerrors.Cause(err) != zbec.ErrNoEntry {
+            t.Fatalf("收到非预期的错误: %v", err)
+        }
+    }
+    if n := atomic.LoadInt32(&loads); n > 1 {
+        t.Fatalf("不存在的key调用了%d次加载器", n)
+    }
+
+    es, err := bec.GetMulti(nil, []*zbec.Query{zbec.NewQuery(space, "2"), zbec.NewQuery(space, "2000")}, new([]int))
+    if err != nil || es[0] != nil || zerrors.Cause(es[1]) != zbec.ErrNoEntry {
+        t.Fatalf("批量获取结果非预期: %v, %v", es, err)
+    }
+
+    // 设置的数据会自动添加到过滤器
+    if err := bec.Set(zbec.NewQuery(space, "3000"), 3000); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := bec.DelData(zbec.NewQuery(space, "3000")); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if ok, _ := filter.Test(context.Background(), zbec.NewQuery(space, "3000").FullPath()); !ok {
+        t.Fatal("设置的数据没有添加到过滤器")
+    }
+}
+
+func TestRedisBloomFilter(t *testing.T) {
+    srv := newTestRedis(t)
+    defer srv.Close()
+    client := srv.Client()
+    defer client.Close()
+
+    ctx := context.Background()
+    filter := redis.NewBloomFilter(client, "test_redis_bloom", 1000, 0.001)
+
+    // 没有构建过的过滤器不会拦截
+    if ok, err := filter.Test(ctx, "none"); err != nil || !ok {
+        t.Fatalf("收到的结果非预期: %v, %v", ok, err)
+    }
+
+    // 重建期间添加的key会同时写入新的过滤器
+    err := filter.Rebuild(ctx, func(add func(keys ...string) error) error {
+        if err := add("1", "2"); err != nil {
+            return err
+        }
+        if err := filter.Rebuild(ctx, func(add func(keys ...string) error) error { return nil }); err == nil {
+            return errors.New("重建时其它进程也获得了重建权")
+        }
+        return filter.Add(ctx, "3")
+    })
+    if err != nil {
+        t.Fatalf("%+v", err)
+    }
+    for _, key := range []string{"1", "2", "3"} {
+        if ok, err := filter.Test(ctx, key); err != nil || !ok {
+            t.Fatalf("过滤器中没有找到 %s: %v", key, err)
+        }
+    }
+    for i := 0; i < 100; i++ {
+        if ok, err := filter.Test(ctx, "none"+strconv.Itoa(i)); err != nil || ok {
+            t.Fatalf("过滤器没有拦截不存在的key: %v, %v", ok, err)
+        }
+    }
+
+    // 重建失败时保留原来的过滤器
+    if err := filter.Rebuild(ctx, func(add func(keys ...string) error) error {
+        return errors.New("db不可用")
+    }); err == nil {
+        t.Fatal("重建失败时没有返回错误")
+    }
+    if ok, err := filter.Test(ctx, "1"); err != nil || !ok {
+        t.Fatalf("重建失败后原来的过滤器被修改: %v", err)
+    }
+    for _, key := range srv.Keys() {
+        if strings.HasSuffix(key, ":rebuilding") || strings.HasSuffix(key, ":pending") {
+            t.Fatalf("重建失败后没有清理: %s", key)
+        }
+    }
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+    space := "test_limit"
+    var running, maxRunning int32
+    block := make(chan struct{})
+    entered := make(chan struct{}, 10)
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        n := atomic.AddInt32(&running, 1)
+        defer atomic.AddInt32(&running, -1)
+        if n > atomic.LoadInt32(&maxRunning) {
+            atomic.StoreInt32(&maxRunning, n)
+        }
+        if query.Params()[0] != "stale" {
+            entered <- struct{}{}
+            <-block
+        }
+        s := query.FullPath()
+        return &s, nil
+    }).SetExpire(time.Millisecond*100, 0).SetServeStaleOnError(time.Second)
+
+    bec := getGoCache()
+    bec.RegisterLoader(loader.SetConcurrencyLimit(1, 1, zbec.OverloadFailFast))
+
+    done := make(chan error, 2)
+    for _, k := range []string{"1", "2"} {
+        go func(k string) {
+            done <- bec.Get(zbec.NewQuery(space, k), new(string))
+        }(k)
+        if k == "1" {
+            <-entered
+        }
+    }
+    time.Sleep(time.Millisecond * 50)
+
+    // 一个正在加载, 一个在排队, 队列已满
+    if err := bec.Get(zbec.NewQuery(space, "3"), new(string)); zerrors.Cause(err) != zbec.ErrLoaderOverloaded {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+    close(block)
+    for i := 0; i < 2; i++ {
+        if err := <-done; err != nil {
+            t.Fatalf("%+v", err)
+        }
+    }
+    if n := atomic.LoadInt32(&maxRunning); n != 1 {
+        t.Fatalf("同时调用加载器的数量为%d", n)
+    }
+    if n := bec.Stats()[space].LoaderRejected; n != 1 {
+        t.Fatalf("被拒绝的次数非预期: %d", n)
+    }
+
+    // 过载时返回过期数据
+    space = "test_limit_stale"
+    block, entered = make(chan struct{}), make(chan struct{}, 10)
+    bec = getGoCache()
+    bec.RegisterLoader(zbec.NewNameLoader(space, loader.Load).
+        SetExpire(time.Millisecond*100, 0).
+        SetServeStaleOnError(time.Second).
+        SetConcurrencyLimit(1, 0, zbec.OverloadServeStale))
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space, "stale"), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    time.Sleep(time.Millisecond * 150)
+
+    go func() {
+        done <- bec.Get(zbec.NewQuery(space, "busy"), new(string))
+    }()
+    <-entered
+
+    a = ""
+    err := bec.Get(zbec.NewQuery(space, "stale"), &a)
+    if zerrors.Cause(err) != zbec.ErrStaleData || a != space+":?stale" {
+        t.Fatalf("收到的结果非预期: %s, %v", a, err)
+    }
+    close(block)
+    if err := <-done; err != nil {
+        t.Fatalf("%+v", err)
+    }
+}
+
+func TestCircuitBreaker(t *testing.T) {
+    space := "test_circuit"
+    var calls int32
+    loader := zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        atomic.AddInt32(&calls, 1)
+        return nil, errors.New("db不可用")
+    }).SetCircuitBreaker("zbec_test_circuit", 50, time.Minute).
+        SetCircuitFallback(func(ctx context.Context, query *query.Query, err error) (interface{}, error) {
+            s := "default"
+            return &s, nil
+        })
+
+    cdb := go_cache.NewGoCache(0)
+    bec := zbec.New(cdb)
+    bec.RegisterLoader(loader)
+
+    var a string
+    for i := 0; i < 200 && a != "default"; i++ {
+        _ = bec.Get(zbec.NewQuery(space, strconv.Itoa(i)), &a)
+        time.Sleep(time.Millisecond)
+    }
+    if a != "default" {
+        t.Fatal("断路器没有打开")
+    }
 
-        a := new(string)
-        err := bec.Get(query, a)
-        if err != nil {
+    n := atomic.LoadInt32(&calls)
+    if err := bec.Get(zbec.NewQuery(space, "x"), &a); err != nil || a != "default" {
+        t.Fatalf("收到的结果非预期: %s, %v", a, err)
+    }
+    if atomic.LoadInt32(&calls) != n {
+        t.Fatal("断路器打开时调用了加载器")
+    }
+    if _, err := cdb.Get(zbec.NewQuery(space, "x"), new(string)); err != zbec.ErrNoEntry {
+        t.Fatalf("降级数据被写入了缓存: %v", err)
+    }
+}
+
+func TestLoadTimeoutAndRetry(t *testing.T) {
+    space := "test_retry"
+    var calls int32
+    bec := getGoCache()
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        n := atomic.AddInt32(&calls, 1)
+        switch query.Params()[0] {
+        case "slow":
+            time.Sleep(time.Millisecond * 200)
+        case "none":
+            return nil, zbec.ErrNoEntry
+        default:
+            if n < 3 {
+                return nil, errors.New("db不可用")
+            }
+        }
+        s := query.FullPath()
+        return &s, nil
+    }).SetTimeout(time.Millisecond * 20).SetRetry(retry.New(3, time.Millisecond, time.Millisecond*10)))
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space, "1"), &a); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if n := atomic.LoadInt32(&calls); n != 3 {
+        t.Fatalf("加载器调用次数非预期: %d", n)
+    }
+
+    atomic.StoreInt32(&calls, 0)
+    if err := bec.Get(zbec.NewQuery(space, "none"), &a); zerrors.Cause(err) != zbec.ErrNoEntry {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+    if n := atomic.LoadInt32(&calls); n != 1 {
+        t.Fatalf("条目不存在时进行了重试: %d", n)
+    }
+
+    start := time.Now()
+    if err := bec.Get(zbec.NewQuery(space, "slow"), &a); zerrors.Cause(err) != zbec.ErrLoadTimeout {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+    if d := time.Since(start); d > time.Millisecond*150 {
+        t.Fatalf("超时没有生效: %s", d)
+    }
+}
+
+func TestConcurrencyLimitTimeout(t *testing.T) {
+    space := "test_limit_timeout"
+    var running int32
+    block := make(chan struct{})
+    bec := getGoCache()
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        atomic.AddInt32(&running, 1)
+        defer atomic.AddInt32(&running, -1)
+        if query.Params()[0] == "slow" {
+            <-block
+        }
+        s := query.FullPath()
+        return &s, nil
+    }).SetTimeout(time.Millisecond*20).SetConcurrencyLimit(1, 0, zbec.OverloadFailFast))
+
+    if err := bec.Get(zbec.NewQuery(space, "slow"), new(string)); zerrors.Cause(err) != zbec.ErrLoadTimeout {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+
+    // 超时的加载器仍在执行, 位置没有释放
+    if err := bec.Get(zbec.NewQuery(space, "1"), new(string)); zerrors.Cause(err) != zbec.ErrLoaderOverloaded {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+
+    close(block)
+    for i := 0; i < 100 && atomic.LoadInt32(&running) > 0; i++ {
+        time.Sleep(time.Millisecond * 5)
+    }
+    var a string
+    if err := bec.Get(zbec.NewQuery(space, "1"), &a); err != nil || a != space+":?1" {
+        t.Fatalf("收到的结果非预期: %s, %v", a, err)
+    }
+}
+
+type closeCounter struct {
+    cachedb.ICacheDB
+    closed int32
+}
+
+func (c *closeCounter) Close() error {
+    atomic.AddInt32(&c.closed, 1)
+    return nil
+}
+
+func TestShutdown(t *testing.T) {
+    space := "test_shutdown"
+    cdb := &closeCounter{ICacheDB: go_cache.NewGoCache(0)}
+    bec := zbec.New(cdb)
+
+    block := make(chan struct{})
+    entered := make(chan struct{})
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        if query.Params()[0] == "1" {
+            close(entered)
+            <-block
+        }
+        s := query.FullPath()
+        return &s, nil
+    }))
+
+    done := make(chan error, 1)
+    go func() {
+        done <- bec.Get(zbec.NewQuery(space, "1"), new(string))
+    }()
+    <-entered
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+    defer cancel()
+    if err := bec.Shutdown(ctx); err == nil {
+        t.Fatal("正在加载时关闭成功了")
+    }
+    if n := atomic.LoadInt32(&cdb.closed); n != 0 {
+        t.Fatal("加载未结束时关闭了缓存数据库")
+    }
+
+    close(block)
+    if err := bec.Shutdown(nil); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if err := <-done; err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if n := atomic.LoadInt32(&cdb.closed); n != 1 {
+        t.Fatalf("缓存数据库关闭次数非预期: %d", n)
+    }
+
+    var a string
+    if err := bec.Get(zbec.NewQuery(space, "1"), &a); err != nil || a != space+":?1" {
+        t.Fatalf("关闭前加载的数据没有写入缓存: %s, %v", a, err)
+    }
+    if err := bec.Get(zbec.NewQuery(space, "2"), &a); zerrors.Cause(err) != zbec.ErrClosed {
+        t.Fatalf("收到的错误非预期: %v", err)
+    }
+    if err := bec.Shutdown(nil); err != nil || atomic.LoadInt32(&cdb.closed) != 1 {
+        t.Fatalf("重复关闭结果非预期: %v", err)
+    }
+}
+
+func TestMemoryCacheFinalizer(t *testing.T) {
+    runtime.GC()
+    before := runtime.NumGoroutine()
+    for i := 0; i < 100; i++ {
+        _ = go_cache.NewGoCache(0)
+        _ = sharded.New()
+    }
+
+    // 没有关闭的缓存不再被引用时后台goroutine会停止
+    for i := 0; i < 50; i++ {
+        runtime.GC()
+        if runtime.NumGoroutine() <= before+10 {
+            return
+        }
+        time.Sleep(time.Millisecond * 10)
+    }
+    t.Fatalf("后台goroutine没有停止: %d -> %d", before, runtime.NumGoroutine())
+}
+
+func TestWarm(t *testing.T) {
+    space := "test_warm"
+    var calls int32
+    bec := getGoCache()
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        atomic.AddInt32(&calls, 1)
+        if query.Params()[0] == "0" {
+            return nil, zbec.ErrNoEntry
+        }
+        s := query.FullPath()
+        return &s, nil
+    }).SetKeys(func(ctx context.Context, fn func(query *query.Query) error) error {
+        for i := 0; i < 100; i++ {
+            if err := fn(zbec.NewQuery(space, strconv.Itoa(i))); err != nil {
+                return err
+            }
+        }
+        return nil
+    }))
+
+    var last zbec.WarmProgress
+    p, err := bec.Warm(nil, space, nil, zbec.WithWarmConcurrency(4), zbec.WithWarmProgress(func(p zbec.WarmProgress) {
+        last = p
+    }))
+    if err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if p.Total != 100 || p.Loaded != 99 || p.NoEntry != 1 || last != p {
+        t.Fatalf("预热进度非预期: %+v, %+v", p, last)
+    }
+
+    atomic.StoreInt32(&calls, 0)
+    var a string
+    if err := bec.Get(zbec.NewQuery(space, "50"), &a); err != nil || a != space+":?50" {
+        t.Fatalf("收到的结果非预期: %s, %v", a, err)
+    }
+
+    p, err = bec.Warm(nil, space, nil, zbec.WithWarmCacheFirst(func() interface{} { return new(string) }))
+    if err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if p.Cached != 99 || p.NoEntry != 1 {
+        t.Fatalf("预热进度非预期: %+v", p)
+    }
+    if n := atomic.LoadInt32(&calls); n != 0 {
+        t.Fatalf("缓存中已有的数据调用了加载器: %d", n)
+    }
+}
+
+func TestGoCacheSnapshot(t *testing.T) {
+    dir, err := ioutil.TempDir("", "zbec")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "snapshot")
+
+    space := "test_snapshot"
+    newBEC := func(fail bool) (*zbec.BECache, cachedb.ICacheDB) {
+        cdb := go_cache.NewGoCache(0, go_cache.WithSnapshot(path, 0), go_cache.WithSnapshotErrorHandler(func(err error) {
             t.Fatalf("%+v", err)
+        }))
+        bec := zbec.New(cdb)
+        bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+            if fail {
+                return nil, errors.New("db不可用")
+            }
+            if query.Params()[0] == "none" {
+                return nil, zbec.ErrNoEntry
+            }
+            s := query.FullPath()
+            return &s, nil
+        }).SetExpire(time.Hour, 0))
+        return bec, cdb
+    }
+
+    bec, cdb := newBEC(false)
+    var a string
+    for _, k := range []string{"1", "2", "none"} {
+        _ = bec.Get(zbec.NewQuery(space, k), &a)
+    }
+    if err := bec.Shutdown(nil); err != nil {
+        t.Fatalf("%+v", err)
+    }
+
+    bec, cdb = newBEC(true)
+    for _, k := range []string{"1", "2"} {
+        a = ""
+        if err := bec.Get(zbec.NewQuery(space, k), &a); err != nil || a != space+":?"+k {
+            t.Fatalf("没有从快照恢复数据: %s, %v", a, err)
         }
+    }
+    if err := bec.Get(zbec.NewQuery(space, "none"), &a); zerrors.Cause(err) != zbec.ErrNoEntry {
+        t.Fatalf("没有从快照恢复空条目: %v", err)
+    }
+    ttl, err := cdb.(cachedb.ITTLCacheDB).TTL(zbec.NewQuery(space, "1"))
+    if err != nil || ttl <= time.Minute*59 || ttl > time.Hour {
+        t.Fatalf("有效时间没有保留: %s, %v", ttl, err)
+    }
 
-        if *a != query.FullPath() {
-            t.Fatalf("收到的值非预期 %s: %s", query.FullPath(), *a)
+    // 后台写入快照时关闭, 最后一次快照在后台写入结束后写入
+    cdb = go_cache.NewGoCache(0, go_cache.WithSnapshot(path, time.Millisecond), go_cache.WithSnapshotErrorHandler(func(err error) {
+        t.Errorf("%+v", err)
+    }))
+    for i := 0; i < 1000; i++ {
+        _ = cdb.Set(zbec.NewQuery(space, strconv.Itoa(i)), strings.Repeat("v", 100), time.Hour)
+    }
+    time.Sleep(time.Millisecond * 10)
+    if err := cdb.(io.Closer).Close(); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+        t.Fatalf("快照目录中有多余的文件: %d", len(files))
+    }
+    restored := go_cache.NewGoCache(0, go_cache.WithSnapshot(path, 0))
+    out, err := restored.Get(zbec.NewQuery(space, "999"), &a)
+    if err != nil || *out.(*string) != strings.Repeat("v", 100) {
+        t.Fatalf("没有从快照恢复数据: %v", err)
+    }
+
+    // 损坏的快照中字段长度超过最大长度或者剩余长度时返回错误
+    corrupt := filepath.Join(dir, "corrupt")
+    for _, size := range []uint64{1 << 62, 1000} {
+        var buf bytes.Buffer
+        buf.WriteString("ZBEC-SNAPSHOT-1\n")
+        var n [binary.MaxVarintLen64]byte
+        buf.Write(n[:binary.PutUvarint(n[:], size)])
+        buf.WriteString("abc")
+        if err := ioutil.WriteFile(corrupt, buf.Bytes(), 0644); err != nil {
+            t.Fatal(err)
+        }
+
+        scdb := go_cache.NewGoCache(0).(go_cache.ISnapshotCacheDB)
+        if err := scdb.Restore(bytes.NewReader(buf.Bytes())); err == nil {
+            t.Fatalf("损坏的快照没有返回错误: %d", size)
+        }
+        if err := scdb.RestoreFile(corrupt); err == nil {
+            t.Fatalf("损坏的快照文件没有返回错误: %d", size)
         }
     }
 }
 
-// go test -v -bench "^Benchmark_.+$" -run ^$ -cpu 20,50,100,1000,10000 .
-// docker run --rm -v $PWD/../..:/src/app -v /src/gopath:/src/gopath -v /src/gocache:/src/gocache -w /src/app/zbec/test zlyuan/golang:1.13 go test -v -bench "^Benchmark_.+$" -run ^$ -cpu 20,50,100,1000,10000 .
+func TestAdminHandler(t *testing.T) {
+    space := "test_admin"
+    bec := zbec.New(go_cache.NewGoCache(0), zbec.WithLocalCacheDB(lru.New(), time.Minute))
+    bec.RegisterLoader(zbec.NewNameLoader(space, func(query *query.Query) (interface{}, error) {
+        s := query.FullPath()
+        return &s, nil
+    }).SetExpire(time.Hour, 0))
+
+    h := admin.New(bec, admin.WithAuthorizer(func(r *http.Request, op string) bool {
+        return op != admin.OpDelSpace
+    }))
+    do := func(method, target string, out interface{}) int {
+        w := httptest.NewRecorder()
+        h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+        if out != nil {
+            if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+                t.Fatalf("%s: %v", w.Body.String(), err)
+            }
+        }
+        return w.Code
+    }
+
+    if err := bec.Get(zbec.NewQuery(space, "1"), new(string)); err != nil {
+        t.Fatalf("%+v", err)
+    }
+
+    var loaders []admin.LoaderInfo
+    if code := do(http.MethodGet, "/zbec/loaders", &loaders); code != http.StatusOK || len(loaders) != 1 || loaders[0].Space != space {
+        t.Fatalf("加载器列表非预期: %d, %+v", code, loaders)
+    }
+
+    var r admin.LookupResult
+    if code := do(http.MethodGet, "/zbec/lookup?space="+space+"&param=1", &r); code != http.StatusOK || len(r.Tiers) != 2 {
+        t.Fatalf("查询结果非预期: %d, %+v", code, r)
+    }
+    for _, e := range r.Tiers {
+        if !e.Found || e.Value != space+":?1" || e.TTL == "" {
+            t.Fatalf("<%s>层的查询结果非预期: %+v", e.Tier, e)
+        }
+    }
+
+    if code := do(http.MethodGet, "/zbec/del?space="+space+"&param=1", nil); code != http.StatusMethodNotAllowed {
+        t.Fatalf("响应码非预期: %d", code)
+    }
+    if code := do(http.MethodPost, "/zbec/del?space="+space+"&param=1", nil); code != http.StatusOK {
+        t.Fatalf("响应码非预期: %d", code)
+    }
+    r = admin.LookupResult{}
+    do(http.MethodGet, "/zbec/lookup?space="+space+"&param=1", &r)
+    for _, e := range r.Tiers {
+        if e.Found {
+            t.Fatalf("<%s>层的数据没有被删除", e.Tier)
+        }
+    }
+
+    if code := do(http.MethodPost, "/zbec/del_space?space="+space, nil); code != http.StatusForbidden {
+        t.Fatalf("响应码非预期: %d", code)
+    }
+
+    // 没有设置授权函数时只允许只读操作
+    h = admin.New(bec)
+    if code := do(http.MethodPost, "/zbec/del?space="+space+"&param=1", nil); code != http.StatusForbidden {
+        t.Fatalf("响应码非预期: %d", code)
+    }
+    if code := do(http.MethodGet, "/zbec/stats", nil); code != http.StatusOK {
+        t.Fatalf("响应码非预期: %d", code)
+    }
+
+    // 查询不影响本地缓存的淘汰顺序
+    local := lru.New(lru.WithMaxEntries(2))
+    bec = zbec.New(nocache.New(), zbec.WithLocalCacheDB(local, time.Minute))
+    h = admin.New(bec)
+    q1, q2, q3 := zbec.NewQuery(space, "1"), zbec.NewQuery(space, "2"), zbec.NewQuery(space, "3")
+    _ = local.Set(q1, "v1", 0)
+    _ = local.Set(q2, "v2", 0)
+    do(http.MethodGet, "/zbec/lookup?space="+space+"&param=1", nil)
+    _ = local.Set(q3, "v3", 0)
+    if _, err := local.Get(q1, new(string)); err != zbec.ErrNoEntry {
+        t.Fatalf("查询后淘汰顺序改变了: %v", err)
+    }
+}
+
+func TestRedisKey(t *testing.T) {
+    client := rredis.NewClient(&rredis.Options{Addr: "127.0.0.1:0"})
+    defer client.Close()
+
+    q := zbec.NewQuery("user", "1", "2")
+    sum := fmt.Sprintf("%x", md5.Sum([]byte(q.Path())))
+    for _, c := range []struct {
+        cdb    cachedb.ICacheDB
+        expect string
+    }{
+        {redis.Wrap(client), redis.MakeKey(q, "", true)},
+        {redis.Wrap(client, redis.WithMd5QueryParams(false)), redis.MakeKey(q, "", false)},
+        {redis_hash.Wrap(client), redis_hash.MakeField(q, true)},
+    } {
+        key, err := c.cdb.(cachedb.IKeyCacheDB).CacheKey(q)
+        if err != nil || key != c.expect {
+            t.Fatalf("key非预期: %s != %s, %v", key, c.expect, err)
+        }
+    }
+    if key := redis.MakeKey(q, "", true); key != "user:"+sum {
+        t.Fatalf("key非预期: %s", key)
+    }
+    if key := redis.MakeKey(q, "3", false); key != "user:3:?1&2" {
+        t.Fatalf("key非预期: %s", key)
+    }
+    if field := redis_hash.MakeField(q, true); field != sum {
+        t.Fatalf("字段名非预期: %s", field)
+    }
+}
+
+func TestRedisDelSpace(t *testing.T) {
+    srv := newTestRedis(t)
+    defer srv.Close()
+    client := srv.Client()
+    defer client.Close()
+
+    set := func(cdb cachedb.ICacheDB, space string) *query.Query {
+        q := zbec.NewQuery(space, "1")
+        if err := cdb.Set(q, "v", 0); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        return q
+    }
+    exists := func(cdb cachedb.ICacheDB, q *query.Query) bool {
+        var a string
+        _, err := cdb.Get(q, &a)
+        if err != nil && err != zbec.ErrNoEntry {
+            t.Fatalf("%+v", err)
+        }
+        return err == nil
+    }
+
+    // 删除空间a不能删除空间a:b和本模块自己的key
+    for _, md5 := range []bool{true, false} {
+        cdb := redis.Wrap(client, redis.WithMd5QueryParams(md5))
+        qa, qab, qzbec := set(cdb, "a"), set(cdb, "a:b"), set(cdb, "zbec")
+        srv.Set(redis.GenerationKeyPrefix+"a", "1")
+        srv.Set(redis.DefaultLockKeyPrefix+fmt.Sprintf("%x", md5Sum("a")), "token")
+
+        if err := cdb.DelSpaceData("a"); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        if exists(cdb, qa) || !exists(cdb, qab) {
+            t.Fatalf("删除空间a的结果非预期, md5: %v", md5)
+        }
+        if err := cdb.DelSpaceData("zbec"); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        if exists(cdb, qzbec) || !exists(cdb, qab) {
+            t.Fatalf("删除空间zbec的结果非预期, md5: %v", md5)
+        }
+        if _, ok := srv.Get(redis.GenerationKeyPrefix + "a"); !ok {
+            t.Fatal("删除空间时删除了空间代数")
+        }
+        if len(srv.Keys()) != 3 {
+            t.Fatalf("剩余的key非预期: %v", srv.Keys())
+        }
+        if err := cdb.DelSpaceData("a:b"); err != nil {
+            t.Fatalf("%+v", err)
+        }
+        for _, key := range srv.Keys() {
+            srv.Del(key)
+        }
+    }
+    if err := redis.Wrap(client).DelSpaceData("a?"); err == nil {
+        t.Fatal("空间名包含?时没有返回错误")
+    }
+
+    // 增加代数删除空间数据
+    cdb := redis.Wrap(client, redis.WithDelSpaceMode(redis.DelSpaceByGeneration), redis.WithGenerationRefresh(0))
+    qa, qab := set(cdb, "a"), set(cdb, "a:b")
+    if err := cdb.DelSpaceData("a"); err != nil {
+        t.Fatalf("%+v", err)
+    }
+    if exists(cdb, qa) || !exists(cdb, qab) {
+        t.Fatal("增加代数删除空间的结果非预期")
+    }
+    if v, _ := srv.Get(redis.GenerationKeyPrefix + "a"); v != "1" {
+        t.Fatalf("空间代数非预期: %s", v)
+    }
+    set(cdb, "a")
+    if !exists(cdb, qa) {
+        t.Fatal("增加代数后无法写入数据")
+    }
+}
+
+func md5Sum(s string) [md5.Size]byte {
+    return md5.Sum([]byte(s))
+}
 
 func Benchmark_GoCache1e3(b *testing.B) {
     bec := getGoCache()
     benchmark_any(b, bec, 1e3)
 }
 
+func Benchmark_Sharded1e3(b *testing.B) {
+    bec := getShardedCache()
+    benchmark_any(b, bec, 1e3)
+}
+
 func Benchmark_Redis1e3(b *testing.B) {
     bec := getRedisClient(false)
     benchmark_any(b, bec, 1e3)
@@ -102,6 +2071,11 @@ func Benchmark_GoCache1e4(b *testing.B) {
     benchmark_any(b, bec, 1e4)
 }
 
+func Benchmark_Sharded1e4(b *testing.B) {
+    bec := getShardedCache()
+    benchmark_any(b, bec, 1e4)
+}
+
 func Benchmark_Redis1e4(b *testing.B) {
     bec := getRedisClient(false)
     benchmark_any(b, bec, 1e4)
@@ -117,6 +2091,11 @@ func Benchmark_GoCache1e5(b *testing.B) {
     benchmark_any(b, bec, 1e5)
 }
 
+func Benchmark_Sharded1e5(b *testing.B) {
+    bec := getShardedCache()
+    benchmark_any(b, bec, 1e5)
+}
+
 func Benchmark_Redis1e5(b *testing.B) {
     bec := getRedisClient(false)
     benchmark_any(b, bec, 1e5)
@@ -0,0 +1,69 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  测试用的redis服务
+-------------------------------------------------
+*/
+
+package test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/alicebob/miniredis/v2"
+    rredis "github.com/go-redis/redis"
+)
+
+// 通过 miniredis 在进程内启动的redis服务, lua脚本会被真正执行
+//
+// 数据的有效时间不会随时间减少, 需要通过 FastForward 让时间前进
+type testRedis struct {
+    *miniredis.Miniredis
+    t *testing.T
+}
+
+func newTestRedis(t *testing.T) *testRedis {
+    s, err := miniredis.Run()
+    if err != nil {
+        t.Fatalf("%+v", err)
+    }
+    return &testRedis{Miniredis: s, t: t}
+}
+
+func (m *testRedis) Client() *rredis.Client {
+    return rredis.NewClient(&rredis.Options{
+        Addr:        m.Addr(),
+        DialTimeout: time.Second,
+    })
+}
+
+// 断开所有客户端连接, 数据会保留
+func (m *testRedis) CloseClients() {
+    m.Close()
+    if err := m.Restart(); err != nil {
+        m.t.Fatalf("%+v", err)
+    }
+}
+
+// 获取集合的所有成员
+func (m *testRedis) Members(key string) []string {
+    members, _ := m.Miniredis.Members(key)
+    return members
+}
+
+func (m *testRedis) Get(key string) (string, bool) {
+    v, err := m.Miniredis.Get(key)
+    return v, err == nil
+}
+
+func (m *testRedis) Set(key, value string) {
+    if err := m.Miniredis.Set(key, value); err != nil {
+        m.t.Fatalf("%+v", err)
+    }
+}
+
+func (m *testRedis) Del(key string) {
+    m.Miniredis.Del(key)
+}
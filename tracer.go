@@ -0,0 +1,115 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  链路追踪
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+
+    "github.com/zlyuancn/zerrors"
+
+    "github.com/zlyuancn/zbec/cachedb"
+)
+
+// span名
+const (
+    // 获取数据
+    SpanGet = "zbec.Get"
+    // 批量获取数据
+    SpanGetMulti = "zbec.GetMulti"
+    // 从单飞模块获取结果, 包含了实际的获取过程或等待其它请求的过程
+    SpanSingleFlight = "zbec.SingleFlight"
+    // 从本地缓存获取
+    SpanLocalGet = "zbec.LocalGet"
+    // 从缓存数据库获取
+    SpanRemoteGet = "zbec.RemoteGet"
+    // 调用加载器
+    SpanLoad = "zbec.Load"
+    // 将加载结果写入缓存
+    SpanWriteBack = "zbec.WriteBack"
+)
+
+// span属性名
+const (
+    // 空间名
+    AttrSpace = "zbec.space"
+    // 数据来源, 值为 ServedFrom
+    AttrServedFrom = "zbec.served_from"
+    // 是否等待了其它请求的结果
+    AttrShared = "zbec.shared"
+    // 缓存数据库的编解码器
+    AttrCodec = "zbec.codec"
+    // 批量获取的数量
+    AttrQueryCount = "zbec.query_count"
+)
+
+// 数据来源
+type ServedFrom string
+
+const (
+    // 本地缓存
+    ServedFromLocal ServedFrom = "local_cdb"
+    // 缓存数据库
+    ServedFromCacheDB ServedFrom = "cdb"
+    // 加载器
+    ServedFromLoader ServedFrom = "loader"
+    // db加载失败时返回的过期数据
+    ServedFromStale ServedFrom = "stale"
+    // 等待其它请求的结果
+    ServedFromShared ServedFrom = "singleflight"
+)
+
+// 链路追踪器, 不依赖任何第三方实现, 可以通过适配器接入 OpenTelemetry 等
+type ITracer interface {
+    // 开始一个span, 返回的ctx应该携带这个span, 以便后续的span成为它的子span
+    Start(ctx context.Context, name string) (context.Context, ISpan)
+}
+
+// span
+type ISpan interface {
+    // 设置属性
+    SetAttribute(key string, value interface{})
+    // 记录错误
+    RecordError(err error)
+    // 结束span
+    End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+// 开始一个span并设置空间属性, 没有设置追踪器时返回的span不做任何事
+func (m *BECache) startSpan(ctx context.Context, name string, query *Query) (context.Context, ISpan) {
+    if m.tracer == nil {
+        return ctx, noopSpan{}
+    }
+
+    ctx, span := m.tracer.Start(ctx, name)
+    if query != nil {
+        span.SetAttribute(AttrSpace, query.Space())
+    }
+    return ctx, span
+}
+
+// 结束span, 如果有错误会记录下来
+func endSpan(span ISpan, err error) {
+    if cause := zerrors.Cause(err); cause != nil && cause != ErrNoEntry && cause != NoEntry {
+        span.RecordError(err)
+    }
+    span.End()
+}
+
+// 设置缓存数据库的编解码器属性
+func setCodecAttr(span ISpan, c cachedb.ICacheDB) {
+    if cc, ok := c.(cachedb.ICodecCacheDB); ok {
+        span.SetAttribute(AttrCodec, cc.CodecType().String())
+    }
+}
@@ -0,0 +1,159 @@
+/*
+-------------------------------------------------
+   Author :       Zhang Fan
+   date：         2026/10/17
+   Description :  缓存预热
+-------------------------------------------------
+*/
+
+package zbec
+
+import (
+    "context"
+    "sync"
+
+    "github.com/zlyuancn/zerrors"
+)
+
+// 默认预热并发数
+const DefaultWarmConcurrency = 16
+
+// 预热进度
+type WarmProgress struct {
+    Total   uint64 // 已处理的key数量
+    Cached  uint64 // 缓存数据库中已有的数量
+    Loaded  uint64 // 从db加载的数量
+    NoEntry uint64 // 不存在的数量
+    Failed  uint64 // 失败的数量
+}
+
+type warmOptions struct {
+    concurrency int
+    progress    func(p WarmProgress)
+    new_value   func() interface{}
+}
+
+// 预热选项
+type WarmOption func(o *warmOptions)
+
+// 设置预热并发数, 默认为 DefaultWarmConcurrency
+func WithWarmConcurrency(n int) WarmOption {
+    return func(o *warmOptions) {
+        if n > 0 {
+            o.concurrency = n
+        }
+    }
+}
+
+// 设置进度回调, 每处理完一个key都会调用, 同一时刻只会有一个goroutine调用
+func WithWarmProgress(fn func(p WarmProgress)) WarmOption {
+    return func(o *warmOptions) {
+        o.progress = fn
+    }
+}
+
+// 先从缓存数据库获取, 缓存数据库没有时才从db加载, 缓存数据库中的数据会写入本地缓存
+// newValue 返回一个用于接收数据的指针, 和调用 Get 时的 a 相同
+// 默认不检查缓存数据库, 直接从db加载并写入缓存数据库和本地缓存
+func WithWarmCacheFirst(newValue func() interface{}) WarmOption {
+    return func(o *warmOptions) {
+        o.new_value = newValue
+    }
+}
+
+// 预热空间, 遍历 keys 返回的所有key并写入缓存, keys 为nil时使用空间加载器的 IKeysLoader.RangeKeys
+// 单个key加载失败不会中断预热, 只会计入失败数量, 遍历出错或ctx结束时返回错误
+// 加载会经过加载器的并发限制丶断路器丶超时和重试设置
+func (m *BECache) Warm(ctx context.Context, space string, keys KeysFn, opts ...WarmOption) (WarmProgress, error) {
+    ctx = makeContext(ctx)
+    o := &warmOptions{concurrency: DefaultWarmConcurrency}
+    for _, fn := range opts {
+        fn(o)
+    }
+
+    loader := m.getLoader(space)
+    if loader == nil {
+        return WarmProgress{}, zerrors.NewSimplef("<%s>加载器为nil", space)
+    }
+    if keys == nil {
+        kloader, ok := loader.(IKeysLoader)
+        if !ok {
+            return WarmProgress{}, zerrors.NewSimplef("<%s>加载器不支持枚举key", space)
+        }
+        keys = kloader.RangeKeys
+    }
+
+    if err := m.beginLoad(); err != nil {
+        return WarmProgress{}, err
+    }
+    defer m.endLoad()
+
+    var progress WarmProgress
+    var mx sync.Mutex
+    report := func(field *uint64) {
+        mx.Lock()
+        progress.Total++
+        *field++
+        if o.progress != nil {
+            o.progress(progress)
+        }
+        mx.Unlock()
+    }
+
+    queries := make(chan *Query)
+    var wg sync.WaitGroup
+    for i := 0; i < o.concurrency; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for query := range queries {
+                report(m.warmOne(ctx, query, loader, o, &progress))
+            }
+        }()
+    }
+
+    err := keys(ctx, func(query *Query) error {
+        if query.Space() != space {
+            return zerrors.NewSimplef("预热<%s>时收到了其它空间的key<%s>", space, query.FullPath())
+        }
+        select {
+        case queries <- query:
+            return nil
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    })
+    close(queries)
+    wg.Wait()
+
+    if err == nil {
+        err = ctx.Err()
+    }
+    if err != nil {
+        return progress, zerrors.WithMessagef(err, "预热<%s>失败", space)
+    }
+    return progress, nil
+}
+
+// 预热一个key, 返回需要增加的计数器
+func (m *BECache) warmOne(ctx context.Context, query *Query, loader ILoader, o *warmOptions, p *WarmProgress) *uint64 {
+    if o.new_value != nil {
+        _, _, err := m.cacheGet(ctx, query, o.new_value(), loader)
+        switch err {
+        case nil:
+            return &p.Cached
+        case NoEntry:
+            return &p.NoEntry
+        }
+    }
+
+    _, err := m.loadDB(ctx, query, loader, false)
+    switch err {
+    case nil:
+        return &p.Loaded
+    case ErrNoEntry:
+        return &p.NoEntry
+    }
+    m.log.Warn(zerrors.WithMessagef(err, "预热失败<%s>", query.FullPath()))
+    return &p.Failed
+}